@@ -0,0 +1,584 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nickng/bibtex"
+)
+
+// BibFile is a parsed BibTeX file. Unlike a Bibliography, it retains the
+// file's @string definitions, macro references and concatenations, so that
+// it can be written back in the form it was written.
+type BibFile struct {
+	Filename string
+	Blocks   []*Block
+}
+
+// BlockKind identifies the kind of a top-level block in a BibTeX file.
+type BlockKind int
+
+// Kinds of block.
+const (
+	EntryBlock BlockKind = iota
+	StringBlock
+	PreambleBlock
+	CommentBlock
+	TextBlock
+)
+
+// Block is a top-level item in a BibTeX file.
+type Block struct {
+	Kind BlockKind
+	Line int
+
+	// Type and Key of an entry, as written.
+	Type string
+	Key  string
+
+	// Fields of an entry, in the order written. A @string block has a single
+	// field holding the macro definition.
+	Fields []Field
+
+	// Value of a @preamble.
+	Value Value
+
+	// Text of a @comment, or text outside of blocks.
+	Text string
+
+	// Attached reports whether a text block is followed by the next block
+	// without a blank line in between.
+	Attached bool
+}
+
+// Field is a named value in a BibTeX entry.
+type Field struct {
+	Name  string
+	Value Value
+	Line  int
+}
+
+// Value is a field value: the concatenation of its parts with "#".
+type Value []ValuePart
+
+// PartKind identifies the kind of part in a field value.
+type PartKind int
+
+// Kinds of value part.
+const (
+	BracedPart PartKind = iota
+	QuotedPart
+	NumberPart
+	MacroPart
+)
+
+// ValuePart is a single operand of a field value. Text holds a literal
+// without its delimiters, or the name of a macro.
+type ValuePart struct {
+	Kind PartKind
+	Text string
+}
+
+// String returns the value in BibTeX syntax. Literals are quoted, unless they
+// contain characters that require braces or are plain numbers.
+func (v Value) String() string {
+	return v.format(false)
+}
+
+// format returns the value in BibTeX syntax, with literals delimited by
+// braces if requested or necessary. Plain numbers are not delimited.
+func (v Value) format(braces bool) string {
+	parts := make([]string, len(v))
+	for i, p := range v {
+		switch {
+		case p.Kind == NumberPart || p.Kind == MacroPart:
+			parts[i] = p.Text
+		case len(v) == 1 && isNumber(p.Text):
+			parts[i] = p.Text
+		case braces || strings.ContainsAny(p.Text, `"{}`):
+			parts[i] = "{" + p.Text + "}"
+		default:
+			parts[i] = `"` + p.Text + `"`
+		}
+	}
+	return strings.Join(parts, " # ")
+}
+
+// Resolve the value by expanding macros and concatenating parts. Macro names
+// are case-insensitive.
+func (v Value) Resolve(macros map[string]string) (string, error) {
+	var b strings.Builder
+	for _, p := range v {
+		if p.Kind != MacroPart {
+			b.WriteString(p.Text)
+			continue
+		}
+		s, ok := macros[strings.ToLower(p.Text)]
+		if !ok {
+			return "", fmt.Errorf("undefined macro %q", p.Text)
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// monthMacros are the predefined BibTeX month abbreviations.
+var monthMacros = map[string]string{
+	"jan": "January",
+	"feb": "February",
+	"mar": "March",
+	"apr": "April",
+	"may": "May",
+	"jun": "June",
+	"jul": "July",
+	"aug": "August",
+	"sep": "September",
+	"oct": "October",
+	"nov": "November",
+	"dec": "December",
+}
+
+// ReadBibFile reads and parses the BibTeX file at path.
+func ReadBibFile(path string) (*BibFile, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBibFile(path, src)
+}
+
+// Bibliography builds a bibliography from the entries in the file. Macros
+// are expanded, and entries with a crossref field inherit the fields they do
+// not define from the referenced entry.
+func (f *BibFile) Bibliography() (*Bibliography, error) {
+	macros := map[string]string{}
+	for name, value := range monthMacros {
+		macros[name] = value
+	}
+
+	b := &Bibliography{}
+	for _, block := range f.Blocks {
+		switch block.Kind {
+		case StringBlock:
+			def := block.Fields[0]
+			value, err := def.Value.Resolve(macros)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", f.Filename, def.Line, err)
+			}
+			macros[strings.ToLower(def.Name)] = value
+
+		case EntryBlock:
+			e := &Entry{
+				BibEntry: *bibtex.NewBibEntry(block.Type, block.Key),
+				Filename: f.Filename,
+				Line:     block.Line,
+			}
+			for _, field := range block.Fields {
+				// As in BibTeX, the first definition of a field takes
+				// precedence.
+				if _, exists := e.Fields[field.Name]; exists {
+					continue
+				}
+				value, err := field.Value.Resolve(macros)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", f.Filename, field.Line, err)
+				}
+				e.AddField(field.Name, bibtex.BibConst(value))
+			}
+			if err := b.AddEntry(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := b.inheritCrossrefs(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// uninherited are fields that describe the referenced entry itself, so are
+// not inherited through a crossref. These include the fingerprint fields,
+// since they are for the content at the parent's own url.
+var uninherited = map[string]bool{
+	"crossref": true,
+	"sha256":   true,
+	"etag":     true,
+	"size":     true,
+}
+
+// inheritCrossrefs copies fields from the entries referenced by crossref
+// fields. The title of the parent becomes the booktitle of the child, as for
+// a paper in conference proceedings, unless the parent has a booktitle of its
+// own.
+func (b *Bibliography) inheritCrossrefs() error {
+	for _, e := range b.Entries {
+		ref, ok := e.Fields["crossref"]
+		if !ok {
+			continue
+		}
+		parent := b.Lookup(ref.String())
+		if parent == nil {
+			return fmt.Errorf("%s: crossref %q not found", e.Position(), ref.String())
+		}
+
+		names := make([]string, 0, len(parent.Fields))
+		for name := range parent.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := parent.Fields[name]
+			if uninherited[name] {
+				continue
+			}
+			if name == "title" {
+				if _, ok := parent.Fields["booktitle"]; ok {
+					continue
+				}
+				name = "booktitle"
+			}
+			if _, exists := e.Fields[name]; !exists {
+				e.AddField(name, value)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseBibFile parses BibTeX source. The filename is only used for position
+// information. As in BibTeX, text outside of blocks is a comment. It is
+// retained in text blocks, so that it can be written back.
+func ParseBibFile(filename string, src []byte) (*BibFile, error) {
+	p := &bibparser{
+		filename: filename,
+		src:      src,
+		lines:    lineOffsets(src),
+	}
+	f := &BibFile{Filename: filename}
+	for {
+		if text := p.text(); text != nil {
+			f.Blocks = append(f.Blocks, text)
+		}
+		if p.pos >= len(p.src) {
+			return f, nil
+		}
+		block, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		f.Blocks = append(f.Blocks, block)
+	}
+}
+
+// bibparser is a recursive descent parser for BibTeX.
+type bibparser struct {
+	filename string
+	src      []byte
+	pos      int
+	lines    []int
+}
+
+// text parses text up to the next block or the end of input, returning nil
+// if there is only whitespace. Lines starting with "%" are comments, which
+// may contain "@".
+func (p *bibparser) text() *Block {
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != '@' {
+		if p.src[p.pos] == '%' && strings.TrimSpace(string(p.src[p.lines[p.line(p.pos)-1]:p.pos])) == "" {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		p.pos++
+	}
+
+	text := string(p.src[start:p.pos])
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return nil
+	}
+
+	lines := strings.Split(trimmed, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRightFunc(lines[i], unicode.IsSpace)
+	}
+
+	after := text[len(strings.TrimRightFunc(text, unicode.IsSpace)):]
+	return &Block{
+		Kind:     TextBlock,
+		Line:     p.line(start + strings.Index(text, trimmed)),
+		Text:     strings.Join(lines, "\n"),
+		Attached: p.pos < len(p.src) && strings.Count(after, "\n") < 2,
+	}
+}
+
+// block parses a block starting at "@".
+func (p *bibparser) block() (*Block, error) {
+	block := &Block{Line: p.line(p.pos)}
+	p.pos++ // @
+	p.space()
+	typ := p.identifier()
+	if typ == "" {
+		return nil, p.errorf("expected block type")
+	}
+
+	p.space()
+	end, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(typ) {
+	case "comment":
+		block.Kind = CommentBlock
+		block.Text, err = p.balanced(end)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+
+	case "preamble":
+		block.Kind = PreambleBlock
+		if block.Value, err = p.value(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+
+	case "string":
+		block.Kind = StringBlock
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		block.Fields = []Field{field}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+
+	default:
+		block.Kind = EntryBlock
+		block.Type = typ
+		if err := p.entry(block, end); err != nil {
+			return nil, err
+		}
+	}
+
+	return block, nil
+}
+
+// entry parses the key and fields of an entry, up to and including the
+// closing delimiter.
+func (p *bibparser) entry(block *Block, end byte) error {
+	p.space()
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != ',' && p.src[p.pos] != end && !isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	block.Key = string(p.src[start:p.pos])
+	if block.Key == "" {
+		return p.errorf("expected citation key")
+	}
+
+	for {
+		p.space()
+		if p.peek() == end {
+			p.pos++
+			return nil
+		}
+		if err := p.expect(','); err != nil {
+			return err
+		}
+		p.space()
+		if p.peek() == end {
+			p.pos++
+			return nil
+		}
+		field, err := p.field()
+		if err != nil {
+			return err
+		}
+		block.Fields = append(block.Fields, field)
+	}
+}
+
+// field parses a "name = value" pair.
+func (p *bibparser) field() (Field, error) {
+	p.space()
+	field := Field{Line: p.line(p.pos)}
+	field.Name = strings.ToLower(p.identifier())
+	if field.Name == "" {
+		return Field{}, p.errorf("expected field name")
+	}
+	if err := p.expect('='); err != nil {
+		return Field{}, err
+	}
+	var err error
+	field.Value, err = p.value()
+	return field, err
+}
+
+// value parses a concatenation of literals, numbers and macros.
+func (p *bibparser) value() (Value, error) {
+	var v Value
+	for {
+		p.space()
+		var part ValuePart
+		switch c := p.peek(); {
+		case c == '{':
+			p.pos++
+			text, err := p.balanced('}')
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			part = ValuePart{Kind: BracedPart, Text: text}
+		case c == '"':
+			p.pos++
+			text, err := p.balanced('"')
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			part = ValuePart{Kind: QuotedPart, Text: text}
+		case '0' <= c && c <= '9':
+			start := p.pos
+			for '0' <= p.peek() && p.peek() <= '9' {
+				p.pos++
+			}
+			part = ValuePart{Kind: NumberPart, Text: string(p.src[start:p.pos])}
+		default:
+			name := p.identifier()
+			if name == "" {
+				return nil, p.errorf("expected field value")
+			}
+			part = ValuePart{Kind: MacroPart, Text: name}
+		}
+		v = append(v, part)
+
+		p.space()
+		if p.peek() != '#' {
+			return v, nil
+		}
+		p.pos++
+	}
+}
+
+// balanced returns text up to the delimiter c outside of braces, leaving the
+// parser positioned at the delimiter.
+func (p *bibparser) balanced(c byte) (string, error) {
+	start := p.pos
+	depth := 0
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '{':
+			depth++
+			continue
+		case '}':
+			if depth > 0 {
+				depth--
+				continue
+			}
+		}
+		if depth == 0 && p.src[p.pos] == c {
+			return string(p.src[start:p.pos]), nil
+		}
+		if depth == 0 && p.src[p.pos] == '}' {
+			return "", p.errorf("unbalanced braces")
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated value")
+}
+
+// open parses an opening delimiter and returns the matching closing
+// delimiter.
+func (p *bibparser) open() (byte, error) {
+	switch p.peek() {
+	case '{':
+		p.pos++
+		return '}', nil
+	case '(':
+		p.pos++
+		return ')', nil
+	}
+	return 0, p.errorf("expected { or (")
+}
+
+// expect consumes the byte c, after any whitespace.
+func (p *bibparser) expect(c byte) error {
+	p.space()
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// identifier parses a field name, macro name or entry type.
+func (p *bibparser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.src) && isIdentifier(p.src[p.pos]) {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+func (p *bibparser) space() {
+	for p.pos < len(p.src) && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// peek returns the next byte, or zero at the end of input.
+func (p *bibparser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// line returns the line number of the given offset.
+func (p *bibparser) line(offset int) int {
+	return sort.SearchInts(p.lines, offset+1)
+}
+
+func (p *bibparser) errorf(format string, args ...interface{}) error {
+	line := p.line(p.pos)
+	col := p.pos - p.lines[line-1] + 1
+	if p.pos >= len(p.src) {
+		return fmt.Errorf("%s:%d:%d: syntax error: unexpected end of file", p.filename, line, col)
+	}
+	return fmt.Errorf("%s:%d:%d: syntax error: %s", p.filename, line, col, fmt.Sprintf(format, args...))
+}
+
+// lineOffsets returns the offsets of the start of each line.
+func lineOffsets(src []byte) []int {
+	offsets := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+// isIdentifier reports whether c may appear in a BibTeX identifier.
+func isIdentifier(c byte) bool {
+	return c > ' ' && c < unicode.MaxASCII && !strings.ContainsRune(`"#%'(),={}`, rune(c))
+}
+
+// isNumber reports whether s is a plain decimal number.
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil && !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+")
+}
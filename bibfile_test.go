@@ -0,0 +1,135 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBibFileBibliography(t *testing.T) {
+	src := `
+@string{iacr = "Cryptology ePrint Archive"}
+@STRING(LNCS = {Lecture Notes in Computer Science})
+
+@misc{report,
+    title  = "Title",
+    howpublished = IACR # ", Report 2020/" # 123,
+    month  = mar,
+}
+
+@inproceedings{paper,
+    title    = "Paper",
+    crossref = "proc",
+    pages    = "1--10",
+}
+
+@proceedings{proc,
+    title  = {Proceedings},
+    series = lncs,
+    year   = 2019,
+}
+
+@inproceedings{talk,
+    title    = "Talk",
+    crossref = "conf",
+}
+
+@proceedings{conf,
+    title     = "Proc Title",
+    booktitle = "Other Book Title",
+}
+`
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bibliography()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]map[string]string{
+		"report": {
+			"howpublished": "Cryptology ePrint Archive, Report 2020/123",
+			"month":        "March",
+		},
+		"paper": {
+			"title":     "Paper",
+			"booktitle": "Proceedings",
+			"series":    "Lecture Notes in Computer Science",
+			"year":      "2019",
+		},
+		"talk": {
+			"title":     "Talk",
+			"booktitle": "Other Book Title",
+		},
+	}
+	for key, fields := range expect {
+		e := b.Lookup(key)
+		if e == nil {
+			t.Fatalf("missing entry %q", key)
+		}
+		for name, value := range fields {
+			if got := e.Field(name); got != value {
+				t.Errorf("%s: field %s = %q; expect %q", key, name, got, value)
+			}
+		}
+	}
+
+	if e := b.Lookup("paper"); e.Line != 11 {
+		t.Errorf("paper defined on line %d; expect 11", e.Line)
+	}
+}
+
+func TestBibFileErrors(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Source string
+		Expect string
+	}{
+		{"syntax", "@misc{key,\n  title = ,\n}", "test.bib:2:11: syntax error: expected field value"},
+		{"eof", "@misc{key, title = {Title}", "test.bib:1:27: syntax error: unexpected end of file"},
+		{"unbalanced", `@misc{key, title = "Ti}tle"}`, "test.bib:1:23: syntax error: unbalanced braces"},
+		{"macro", "@misc{key,\n  title = undefined,\n}", `test.bib:2: undefined macro "undefined"`},
+		{"crossref", "@misc{key,\n  crossref = {missing},\n}", `test.bib:1: crossref "missing" not found`},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			f, err := ParseBibFile("test.bib", []byte(c.Source))
+			if err == nil {
+				_, err = f.Bibliography()
+			}
+			if err == nil || err.Error() != c.Expect {
+				t.Fatalf("got error %v; expect %s", err, c.Expect)
+			}
+		})
+	}
+}
+
+func TestBibFileStrayText(t *testing.T) {
+	// As in BibTeX, text outside of blocks is a comment rather than an error,
+	// whether or not it starts with "%".
+	src := "0000\n\n@misc{key,\n    title = \"Title\",\n}\ntrailing text\n"
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text []string
+	for _, block := range f.Blocks {
+		if block.Kind == TextBlock {
+			text = append(text, block.Text)
+		}
+	}
+	if !reflect.DeepEqual(text, []string{"0000", "trailing text"}) {
+		t.Errorf("got text blocks %q", text)
+	}
+
+	b, err := f.Bibliography()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Entries) != 1 || b.Entries[0].CiteName != "key" {
+		t.Errorf("got %d entries; expect only key", len(b.Entries))
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EntryOrder reports whether entry a should be placed before entry b.
+type EntryOrder func(a, b *Block) bool
+
+// entryOrders is the registry of entry orders for formatting. The nil order
+// keeps entries as written.
+var entryOrders = map[string]EntryOrder{
+	"key":  byKey,
+	"type": byTypeKey,
+	"year": byYearKey,
+	"none": nil,
+}
+
+// LookupEntryOrder returns the named entry order.
+func LookupEntryOrder(name string) (EntryOrder, error) {
+	order, ok := entryOrders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort order %q", name)
+	}
+	return order, nil
+}
+
+// EntryOrderNames returns the names of entry orders.
+func EntryOrderNames() []string {
+	names := []string{}
+	for name := range entryOrders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// byKey orders entries by citation key.
+func byKey(a, b *Block) bool { return a.Key < b.Key }
+
+// byTypeKey orders entries by type, and then citation key.
+func byTypeKey(a, b *Block) bool {
+	ta, tb := strings.ToLower(a.Type), strings.ToLower(b.Type)
+	if ta != tb {
+		return ta < tb
+	}
+	return byKey(a, b)
+}
+
+// byYearKey orders entries by year, and then citation key. Entries without a
+// year come first.
+func byYearKey(a, b *Block) bool {
+	ya, yb := blockYear(a), blockYear(b)
+	if ya != yb {
+		return ya < yb
+	}
+	return byKey(a, b)
+}
+
+// blockYear returns the year of an entry from its date or year field, or zero
+// if it has neither. Macros are not expanded.
+func blockYear(b *Block) int {
+	for _, field := range b.Fields {
+		var text strings.Builder
+		for _, part := range field.Value {
+			if part.Kind != MacroPart {
+				text.WriteString(part.Text)
+			}
+		}
+		switch field.Name {
+		case "date":
+			if r, err := ParseDateRange(text.String()); err == nil {
+				return r.Start.Year
+			}
+		case "year":
+			if year, err := strconv.Atoi(strings.TrimSpace(text.String())); err == nil {
+				return year
+			}
+		}
+	}
+	return 0
+}
+
+// FormatOptions configures BibTeX formatting.
+type FormatOptions struct {
+	// Indent for the fields of an entry.
+	Indent string
+
+	// Align the "=" signs of fields in each entry.
+	Align bool
+
+	// Braces delimits literal values with braces. Otherwise values are
+	// quoted, unless they contain characters that require braces.
+	Braces bool
+
+	// TrailingComma after the last field of an entry.
+	TrailingComma bool
+
+	// PreserveType keeps the case of entry types as written, rather than
+	// converting them to lowercase.
+	PreserveType bool
+
+	// FieldOrder lists fields that are placed first, in the order given.
+	// Other fields follow in alphabetical order.
+	FieldOrder []string
+
+	// Sort orders entries. Comments and other blocks stay in place, and
+	// entries are sorted within the sections between them. If nil, entries
+	// keep the order of the file.
+	Sort EntryOrder
+}
+
+// DefaultFormatOptions is the canonical format.
+var DefaultFormatOptions = FormatOptions{
+	Indent:        "    ",
+	Align:         true,
+	TrailingComma: true,
+	FieldOrder:    []string{"title", "author", "url"},
+	Sort:          byKey,
+}
+
+// FormatBibTeX outputs the file in a canonical format. Blocks are separated
+// by a blank line, except where a comment was directly followed by a block.
+func FormatBibTeX(f *BibFile, opts FormatOptions) []byte {
+	blocks := append([]*Block{}, f.Blocks...)
+	if opts.Sort != nil {
+		sortSections(blocks, opts.Sort)
+	}
+
+	var buf strings.Builder
+	for i, block := range blocks {
+		if i > 0 && !blocks[i-1].Attached {
+			buf.WriteString("\n")
+		}
+		formatBlock(&buf, block, opts)
+	}
+	return []byte(buf.String())
+}
+
+// sortSections sorts each run of consecutive entries.
+func sortSections(blocks []*Block, less EntryOrder) {
+	start := 0
+	for i := 0; i <= len(blocks); i++ {
+		if i < len(blocks) && blocks[i].Kind == EntryBlock {
+			continue
+		}
+		section := blocks[start:i]
+		sort.SliceStable(section, func(a, b int) bool { return less(section[a], section[b]) })
+		start = i + 1
+	}
+}
+
+func formatBlock(buf *strings.Builder, block *Block, opts FormatOptions) {
+	switch block.Kind {
+	case TextBlock:
+		fmt.Fprintf(buf, "%s\n", block.Text)
+
+	case CommentBlock:
+		fmt.Fprintf(buf, "@comment{%s}\n", block.Text)
+
+	case PreambleBlock:
+		fmt.Fprintf(buf, "@preamble{%s}\n", block.Value.format(opts.Braces))
+
+	case StringBlock:
+		def := block.Fields[0]
+		fmt.Fprintf(buf, "@string{%s = %s}\n", def.Name, def.Value.format(opts.Braces))
+
+	case EntryBlock:
+		formatEntry(buf, block, opts)
+	}
+}
+
+func formatEntry(buf *strings.Builder, block *Block, opts FormatOptions) {
+	typ := block.Type
+	if !opts.PreserveType {
+		typ = strings.ToLower(typ)
+	}
+	fmt.Fprintf(buf, "@%s{%s,\n", typ, block.Key)
+
+	// Order fields.
+	priority := map[string]int{}
+	for i, name := range opts.FieldOrder {
+		priority[name] = i - len(opts.FieldOrder)
+	}
+	fields := append([]Field{}, block.Fields...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		pi, pj := priority[fields[i].Name], priority[fields[j].Name]
+		return pi < pj || (pi == pj && fields[i].Name < fields[j].Name)
+	})
+
+	// Write fields, padding names to align the "=" signs if requested.
+	width := 0
+	if opts.Align {
+		for _, field := range fields {
+			if len(field.Name) > width {
+				width = len(field.Name)
+			}
+		}
+	}
+	for i, field := range fields {
+		comma := ","
+		if i == len(fields)-1 && !opts.TrailingComma {
+			comma = ""
+		}
+		fmt.Fprintf(buf, "%s%-*s = %s%s\n", opts.Indent, width, field.Name, field.Value.format(opts.Braces), comma)
+	}
+	buf.WriteString("}\n")
+}
@@ -0,0 +1,175 @@
+package main
+
+import "testing"
+
+func TestFormatBibTeX(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Source string
+		Sort   string
+		Expect string
+	}{
+		{
+			Name: "unresolved",
+			Source: `@string{iacr = "Cryptology ePrint Archive"}
+@misc{b, note = iacr # " " # {{Go}}, month = jan, year = "2020"}
+@misc{a, title = "Title"}
+`,
+			Sort: "key",
+			Expect: `@string{iacr = "Cryptology ePrint Archive"}
+
+@misc{a,
+    title = "Title",
+}
+
+@misc{b,
+    month = jan,
+    note  = iacr # " " # {{Go}},
+    year  = 2020,
+}
+`,
+		},
+		{
+			Name: "sections",
+			Source: `%%
+%% Section One
+%%
+
+@misc{b, title = "B"}
+@misc{a, title = "A"}
+
+@comment{Section Two}
+@preamble{"\newcommand{\noop}[1]{}"}
+% Entries C and D. Contact email@example.com.
+@misc{d, title = "D"}  @misc{c, title = "C"}
+
+Trailing text.
+`,
+			Sort: "key",
+			Expect: `%%
+%% Section One
+%%
+
+@misc{a,
+    title = "A",
+}
+
+@misc{b,
+    title = "B",
+}
+
+@comment{Section Two}
+
+@preamble{{\newcommand{\noop}[1]{}}}
+
+% Entries C and D. Contact email@example.com.
+@misc{c,
+    title = "C",
+}
+
+@misc{d,
+    title = "D",
+}
+
+Trailing text.
+`,
+		},
+		{
+			Name: "none",
+			Source: `% Header
+@misc{b, title = "B"}
+@misc{a, title = "A"}
+`,
+			Sort: "none",
+			Expect: `% Header
+@misc{b,
+    title = "B",
+}
+
+@misc{a,
+    title = "A",
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			order, err := LookupEntryOrder(c.Sort)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := DefaultFormatOptions
+			opts.Sort = order
+
+			f, err := ParseBibFile("test.bib", []byte(c.Source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(FormatBibTeX(f, opts))
+			if got != c.Expect {
+				t.Fatalf("got:\n%s\nexpect:\n%s", got, c.Expect)
+			}
+
+			// Formatting should be idempotent.
+			again, err := ParseBibFile("test.bib", []byte(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(FormatBibTeX(again, opts)) != got {
+				t.Fatal("formatting is not idempotent")
+			}
+		})
+	}
+}
+
+func TestFormatBibTeXOptions(t *testing.T) {
+	src := `@InProceedings{b, Year = 2019, Title = "B", BookTitle = {Proc.}, Author = "Gopher, Go"}
+@Article{c, title = "C", date = "2018-03"}
+@Misc{a, title = "A", year = "2020"}
+`
+	cases := []struct {
+		Name    string
+		Options FormatOptions
+		Expect  string
+	}{
+		{
+			Name: "house",
+			Options: FormatOptions{
+				Indent:       "\t",
+				Braces:       true,
+				PreserveType: true,
+				FieldOrder:   []string{"author", "title", "booktitle", "year", "url"},
+				Sort:         byTypeKey,
+			},
+			Expect: "@Article{c,\n\ttitle = {C},\n\tdate = {2018-03}\n}\n" +
+				"\n@InProceedings{b,\n\tauthor = {Gopher, Go},\n\ttitle = {B},\n\tbooktitle = {Proc.},\n\tyear = 2019\n}\n" +
+				"\n@Misc{a,\n\ttitle = {A},\n\tyear = 2020\n}\n",
+		},
+		{
+			Name: "year",
+			Options: FormatOptions{
+				Indent:        "  ",
+				Align:         true,
+				TrailingComma: true,
+				Sort:          byYearKey,
+			},
+			Expect: "@article{c,\n  date  = \"2018-03\",\n  title = \"C\",\n}\n" +
+				"\n@inproceedings{b,\n  author    = \"Gopher, Go\",\n  booktitle = \"Proc.\",\n  title     = \"B\",\n  year      = 2019,\n}\n" +
+				"\n@misc{a,\n  title = \"A\",\n  year  = 2020,\n}\n",
+		},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			f, err := ParseBibFile("test.bib", []byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(FormatBibTeX(f, c.Options))
+			if got != c.Expect {
+				t.Fatalf("got:\n%s\nexpect:\n%s", got, c.Expect)
+			}
+		})
+	}
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"errors"
 	"fmt"
-	"os"
-	"sort"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,19 +14,73 @@ import (
 // Entry in a bibliography.
 type Entry struct {
 	bibtex.BibEntry
+
+	// Filename and Line record where the entry was defined, if known.
+	Filename string
+	Line     int
+}
+
+// Position returns a description of where the entry was defined.
+func (e Entry) Position() string {
+	if e.Filename == "" {
+		return "unknown position"
+	}
+	return fmt.Sprintf("%s:%d", e.Filename, e.Line)
 }
 
 // Authors returns the list of authors.
-func (e Entry) Authors() []string {
+func (e Entry) Authors() []Person {
 	field, found := e.Fields["author"]
 	if !found {
 		return nil
 	}
-	authors := strings.Split(field.String(), " and ")
-	for i := range authors {
-		authors[i] = strings.TrimSpace(authors[i])
+	return ParseNames(field.String())
+}
+
+// Editors returns the list of editors.
+func (e Entry) Editors() []Person {
+	field, found := e.Fields["editor"]
+	if !found {
+		return nil
+	}
+	return ParseNames(field.String())
+}
+
+// verbatim lists fields whose values are identifiers rather than text, and
+// therefore are not decoded from LaTeX.
+var verbatim = map[string]bool{
+	"url":        true,
+	"urldate":    true,
+	"mirror":     true,
+	"archiveurl": true,
+	"doi":        true,
+	"eprint":     true,
+	"isbn":       true,
+	"issn":       true,
+	"file":       true,
+	"sha256":     true,
+	"etag":       true,
+	"size":       true,
+}
+
+// Field returns the value of the named field with LaTeX markup decoded, or
+// the empty string if the field does not exist.
+func (e Entry) Field(name string) string {
+	value, _ := e.field(name, PlainText)
+	return value
+}
+
+// field returns the value of the named field rendered with the given markup,
+// and whether it was found.
+func (e Entry) field(name string, m Markup) (string, bool) {
+	value, found := e.Fields[name]
+	if !found {
+		return "", false
+	}
+	if verbatim[name] {
+		return m.Text(value.String()), true
 	}
-	return authors
+	return DecodeLaTeX(value.String(), m), true
 }
 
 // DateField parses a field as a date in ISO 8601 format.
@@ -38,6 +92,31 @@ func (e Entry) DateField(name string) (time.Time, error) {
 	return time.Parse("2006-01-02", s.String())
 }
 
+// Date returns the date of the entry, from the BibLaTeX date field or else the
+// year and month fields. Returns the zero DateRange if the entry has no valid
+// date.
+func (e Entry) Date() DateRange {
+	if date, ok := e.Fields["date"]; ok {
+		if r, err := ParseDateRange(date.String()); err == nil {
+			return r
+		}
+	}
+
+	year, ok := e.Fields["year"]
+	if !ok {
+		return DateRange{}
+	}
+	var d Date
+	var err error
+	if d.Year, err = strconv.Atoi(strings.TrimSpace(year.String())); err != nil {
+		return DateRange{}
+	}
+	if month, ok := e.Fields["month"]; ok {
+		d.Month, _ = ParseMonth(month.String())
+	}
+	return DateRange{Start: d}
+}
+
 // ByCiteName sorts a list of entries by their citation name.
 type ByCiteName []*Entry
 
@@ -45,43 +124,98 @@ func (e ByCiteName) Len() int           { return len(e) }
 func (e ByCiteName) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
 func (e ByCiteName) Less(i, j int) bool { return e[i].CiteName < e[j].CiteName }
 
+// ByDate sorts a list of entries by date, and then by citation name.
+type ByDate []*Entry
+
+func (e ByDate) Len() int      { return len(e) }
+func (e ByDate) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e ByDate) Less(i, j int) bool {
+	di, dj := e[i].Date().Start, e[j].Date().Start
+	if di != dj {
+		return di.Before(dj)
+	}
+	return e[i].CiteName < e[j].CiteName
+}
+
 // Bibliography is a collection of references.
 type Bibliography struct {
 	Entries []*Entry
 }
 
 // ReadBibliography reads entries from the given BiBTeX file.
-func ReadBibliography(path string) (b *Bibliography, err error) {
-	f, err := os.Open(path)
+func ReadBibliography(path string) (*Bibliography, error) {
+	f, err := ReadBibFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if errc := f.Close(); err == nil && errc != nil {
-			err = errc
+	return f.Bibliography()
+}
+
+// BibliographyFile is a bibliography file with an optional namespace. When
+// merged into a bibliography, entry keys are prefixed with "<namespace>:".
+type BibliographyFile struct {
+	Path      string
+	Namespace string
+}
+
+// ParseBibliographyFiles parses bibliography file specifications of the form
+// "[<namespace>=]<path>", where path may be a glob pattern.
+func ParseBibliographyFiles(specs []string) ([]BibliographyFile, error) {
+	var files []BibliographyFile
+	for _, spec := range specs {
+		namespace, pattern := "", spec
+		if i := strings.Index(spec, "="); i >= 0 {
+			namespace, pattern = spec[:i], spec[i+1:]
 		}
-	}()
 
-	bib, err := bibtex.Parse(f)
-	if err != nil {
-		return nil, err
+		// Patterns without metacharacters are taken literally, so that a
+		// missing file produces an error when it is read.
+		paths := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no bibliography files match %q", pattern)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			files = append(files, BibliographyFile{
+				Path:      path,
+				Namespace: namespace,
+			})
+		}
 	}
+	return files, nil
+}
 
-	// Build.
-	b = &Bibliography{}
-	for _, e := range bib.Entries {
-		if err := b.AddEntry(&Entry{BibEntry: *e}); err != nil {
+// ReadBibliographies reads and merges entries from the given files.
+func ReadBibliographies(files []BibliographyFile) (*Bibliography, error) {
+	merged := &Bibliography{}
+	for _, file := range files {
+		b, err := ReadBibliography(file.Path)
+		if err != nil {
 			return nil, err
 		}
+		for _, e := range b.Entries {
+			if file.Namespace != "" {
+				e.CiteName = file.Namespace + ":" + e.CiteName
+			}
+			if err := merged.AddEntry(e); err != nil {
+				return nil, err
+			}
+		}
 	}
-
-	return b, nil
+	return merged, nil
 }
 
 // AddEntry adds an entry to the bibliography.
 func (b *Bibliography) AddEntry(e *Entry) error {
-	if b.Lookup(e.CiteName) != nil {
-		return fmt.Errorf("key %q already in bibliography", e.CiteName)
+	if existing := b.Lookup(e.CiteName); existing != nil {
+		return fmt.Errorf("%s: key %q already in bibliography (previously defined at %s)", e.Position(), e.CiteName, existing.Position())
 	}
 	b.Entries = append(b.Entries, e)
 	return nil
@@ -96,19 +230,3 @@ func (b *Bibliography) Lookup(key string) *Entry {
 	}
 	return nil
 }
-
-// FormatBibTeX outputs b in a canonical format.
-func FormatBibTeX(b *Bibliography) []byte {
-	// Sort entries.
-	sorted := make([]*Entry, len(b.Entries))
-	copy(sorted, b.Entries)
-	sort.Sort(ByCiteName(sorted))
-
-	// Convert to bibtex package type and use pretty printing.
-	bib := bibtex.NewBibTex()
-	for _, entry := range sorted {
-		bib.AddEntry(&entry.BibEntry)
-	}
-
-	return []byte(bib.PrettyString())
-}
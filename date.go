@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is a calendar date that may be partial. Month and Day are zero when
+// unspecified.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// isodate matches a partial ISO 8601 date.
+var isodate = regexp.MustCompile(`^(\d{4})(?:-(\d{2})(?:-(\d{2}))?)?$`)
+
+// ParseDate parses a date in one of the ISO 8601 forms "2006", "2006-01" or
+// "2006-01-02".
+func ParseDate(s string) (Date, error) {
+	m := isodate.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+
+	var d Date
+	d.Year, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		month, _ := strconv.Atoi(m[2])
+		d.Month = time.Month(month)
+		if d.Month < time.January || d.Month > time.December {
+			return Date{}, fmt.Errorf("invalid month in date %q", s)
+		}
+	}
+	if m[3] != "" {
+		d.Day, _ = strconv.Atoi(m[3])
+		t := time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC)
+		if d.Day < 1 || t.Day() != d.Day {
+			return Date{}, fmt.Errorf("invalid day in date %q", s)
+		}
+	}
+
+	return d, nil
+}
+
+// IsZero reports whether the date is unspecified.
+func (d Date) IsZero() bool { return d == Date{} }
+
+// Before reports whether d is before u. Unspecified parts sort first.
+func (d Date) Before(u Date) bool {
+	if d.Year != u.Year {
+		return d.Year < u.Year
+	}
+	if d.Month != u.Month {
+		return d.Month < u.Month
+	}
+	return d.Day < u.Day
+}
+
+// String returns the date in ISO 8601 form.
+func (d Date) String() string {
+	switch {
+	case d.IsZero():
+		return ""
+	case d.Month == 0:
+		return fmt.Sprintf("%04d", d.Year)
+	case d.Day == 0:
+		return fmt.Sprintf("%04d-%02d", d.Year, d.Month)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Long returns the date in a readable form, such as "March 2020" or "March
+// 5, 2020".
+func (d Date) Long() string {
+	switch {
+	case d.IsZero():
+		return ""
+	case d.Month == 0:
+		return strconv.Itoa(d.Year)
+	case d.Day == 0:
+		return fmt.Sprintf("%s %d", d.Month, d.Year)
+	}
+	return fmt.Sprintf("%s %d, %d", d.Month, d.Day, d.Year)
+}
+
+// DateRange is a date, or a range of dates if End is specified.
+type DateRange struct {
+	Start Date
+	End   Date
+
+	// OpenStart and OpenEnd mark a range with an unknown start or end, and a
+	// zero Start or End respectively.
+	OpenStart bool
+	OpenEnd   bool
+}
+
+// ParseDateRange parses a date or a range of dates separated by a slash, as
+// in the BibLaTeX date field. For example "2020-03/2020-05". The start or end
+// of a range may be empty or "..", as in "2020/" or "../2020", for an
+// open-ended range.
+func ParseDateRange(s string) (DateRange, error) {
+	start, end, ranged := s, "", false
+	if i := strings.Index(s, "/"); i >= 0 {
+		start, end, ranged = s[:i], s[i+1:], true
+	}
+
+	var r DateRange
+	var err error
+	r.OpenStart = ranged && openDate(start)
+	r.OpenEnd = ranged && openDate(end)
+	if r.OpenStart && r.OpenEnd {
+		return DateRange{}, fmt.Errorf("date range %q has neither start nor end", s)
+	}
+
+	if !r.OpenStart {
+		if r.Start, err = ParseDate(start); err != nil {
+			return DateRange{}, err
+		}
+	}
+	if !ranged || r.OpenEnd {
+		return r, nil
+	}
+
+	if r.End, err = ParseDate(end); err != nil {
+		return DateRange{}, err
+	}
+	if r.OpenStart {
+		return r, nil
+	}
+	if r.End.Before(r.Start) {
+		return DateRange{}, fmt.Errorf("date range %q ends before it starts", s)
+	}
+	return r, nil
+}
+
+// openDate reports whether s is the unknown start or end of a date range.
+func openDate(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s == ".."
+}
+
+// IsZero reports whether the date range is unspecified.
+func (r DateRange) IsZero() bool { return r.Start.IsZero() && r.End.IsZero() }
+
+// String returns the date range in ISO 8601 form, with ".." for an unknown
+// start or end.
+func (r DateRange) String() string {
+	switch {
+	case r.OpenStart:
+		return "../" + r.End.String()
+	case r.OpenEnd:
+		return r.Start.String() + "/.."
+	case r.End.IsZero():
+		return r.Start.String()
+	}
+	return r.Start.String() + "/" + r.End.String()
+}
+
+// Year returns the years of the date range, such as "2019–2020" or "2020–"
+// for a range with an unknown end.
+func (r DateRange) Year() string {
+	s, e := strconv.Itoa(r.Start.Year), strconv.Itoa(r.End.Year)
+	switch {
+	case r.IsZero():
+		return ""
+	case r.OpenStart:
+		return "–" + e
+	case r.OpenEnd:
+		return s + "–"
+	case r.End.IsZero() || r.End.Year == r.Start.Year:
+		return s
+	}
+	return s + "–" + e
+}
+
+// Long returns the date range in a readable form, such as "March–May 2020",
+// omitting parts that the start and end have in common.
+func (r DateRange) Long() string {
+	s, e := r.Start, r.End
+	switch {
+	case r.OpenStart:
+		return "–" + e.Long()
+	case r.OpenEnd:
+		return s.Long() + "–"
+	case e.IsZero() || s == e:
+		return s.Long()
+	case s.Year != e.Year || s.Month == 0 || e.Month == 0 || (s.Day == 0) != (e.Day == 0):
+		return s.Long() + "–" + e.Long()
+	case s.Day == 0:
+		return fmt.Sprintf("%s–%s %d", s.Month, e.Month, s.Year)
+	case s.Month == e.Month:
+		return fmt.Sprintf("%s %d–%d, %d", s.Month, s.Day, e.Day, s.Year)
+	}
+	return fmt.Sprintf("%s %d–%s %d, %d", s.Month, s.Day, e.Month, e.Day, s.Year)
+}
+
+// ParseMonth parses a month given as a name, a three-letter abbreviation as
+// in the BibTeX month macros, or a number.
+func ParseMonth(s string) (time.Month, error) {
+	v := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")
+	if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 12 {
+		return time.Month(n), nil
+	}
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		if v == name || v == name[:3] {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid month %q", s)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Expect DateRange
+		Long   string
+	}{
+		{"2020", DateRange{Start: Date{Year: 2020}}, "2020"},
+		{"2020-03", DateRange{Start: Date{Year: 2020, Month: time.March}}, "March 2020"},
+		{"2020-03-05", DateRange{Start: Date{Year: 2020, Month: time.March, Day: 5}}, "March 5, 2020"},
+		{"2019/2020", DateRange{Start: Date{Year: 2019}, End: Date{Year: 2020}}, "2019–2020"},
+		{"2020-03/2020-05", DateRange{Start: Date{Year: 2020, Month: time.March}, End: Date{Year: 2020, Month: time.May}}, "March–May 2020"},
+		{"2020-03-05/2020-03-07", DateRange{Start: Date{Year: 2020, Month: time.March, Day: 5}, End: Date{Year: 2020, Month: time.March, Day: 7}}, "March 5–7, 2020"},
+		{"2020-03-30/2020-04-02", DateRange{Start: Date{Year: 2020, Month: time.March, Day: 30}, End: Date{Year: 2020, Month: time.April, Day: 2}}, "March 30–April 2, 2020"},
+		{"2019-12/2020-01", DateRange{Start: Date{Year: 2019, Month: time.December}, End: Date{Year: 2020, Month: time.January}}, "December 2019–January 2020"},
+		{"2020-03/..", DateRange{Start: Date{Year: 2020, Month: time.March}, OpenEnd: true}, "March 2020–"},
+		{"../2020", DateRange{End: Date{Year: 2020}, OpenStart: true}, "–2020"},
+	}
+	for _, c := range cases {
+		got, err := ParseDateRange(c.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.Expect {
+			t.Errorf("ParseDateRange(%q) = %#v; expect %#v", c.Input, got, c.Expect)
+		}
+		if got.String() != c.Input {
+			t.Errorf("ParseDateRange(%q).String() = %q", c.Input, got.String())
+		}
+		if got.Long() != c.Long {
+			t.Errorf("ParseDateRange(%q).Long() = %q; expect %q", c.Input, got.Long(), c.Long)
+		}
+	}
+}
+
+func TestDateRangeYear(t *testing.T) {
+	cases := map[string]string{
+		"2020-03":         "2020",
+		"2020-03/2020-05": "2020",
+		"2019/2020":       "2019–2020",
+		"2020/":           "2020–",
+		"../2020":         "–2020",
+	}
+	for input, expect := range cases {
+		r, err := ParseDateRange(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Year(); got != expect {
+			t.Errorf("ParseDateRange(%q).Year() = %q; expect %q", input, got, expect)
+		}
+	}
+}
+
+func TestParseDateRangeErrors(t *testing.T) {
+	for _, input := range []string{"", "20", "March 2020", "2020-13", "2020-02-30", "2020/19", "2020-05/2020-03", "/", "../..", "2020/x"} {
+		if _, err := ParseDateRange(input); err == nil {
+			t.Errorf("ParseDateRange(%q) expected error", input)
+		}
+	}
+}
+
+func TestParseMonth(t *testing.T) {
+	cases := map[string]time.Month{
+		"jan":       time.January,
+		"Feb":       time.February,
+		"sept":      0,
+		"Sep.":      time.September,
+		"October":   time.October,
+		"11":        time.November,
+		"01":        time.January,
+		"13":        0,
+		"Christmas": 0,
+	}
+	for input, expect := range cases {
+		got, err := ParseMonth(input)
+		if expect == 0 {
+			if err == nil {
+				t.Errorf("ParseMonth(%q) expected error", input)
+			}
+			continue
+		}
+		if err != nil || got != expect {
+			t.Errorf("ParseMonth(%q) = %v, %v; expect %v", input, got, err, expect)
+		}
+	}
+}
+
+func TestEntryDate(t *testing.T) {
+	cases := []struct {
+		Fields map[string]string
+		Expect string
+	}{
+		{map[string]string{"year": "2020"}, "2020"},
+		{map[string]string{"year": "2020", "month": "March"}, "2020-03"},
+		{map[string]string{"year": "2020", "month": "mar"}, "2020-03"},
+		{map[string]string{"year": "2020", "month": "03"}, "2020-03"},
+		{map[string]string{"date": "2020-03-05", "year": "2019"}, "2020-03-05"},
+		{map[string]string{"date": "2020-03/2020-05"}, "2020-03/2020-05"},
+		{map[string]string{"date": "2020/", "year": "2019"}, "2020/.."},
+		{map[string]string{"date": "../2020", "year": "2019"}, "../2020"},
+		{map[string]string{"year": "to appear"}, ""},
+		{map[string]string{}, ""},
+	}
+	for _, c := range cases {
+		e := TestEntry{Type: "misc", Name: "date", Fields: c.Fields}.Entry()
+		if got := e.Date().String(); got != c.Expect {
+			t.Errorf("%v: Date() = %q; expect %q", c.Fields, got, c.Expect)
+		}
+	}
+}
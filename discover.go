@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultBibliographyName is the bibliography filename searched for when none
+// is given explicitly.
+const DefaultBibliographyName = "references.bib"
+
+// FindBibliography searches for a bibliography file with the given name in dir
+// and its parents. The search stops at the module root, the first directory
+// containing a go.mod file.
+func FindBibliography(dir, name string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for start := dir; ; {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+
+		// Stop at the module root or filesystem root.
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return "", fmt.Errorf("no bibliography %q found between %s and module root %s", name, start, dir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no bibliography %q found in %s or any parent directory", name, start)
+		}
+		dir = parent
+	}
+}
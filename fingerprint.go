@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// fingerprintFields are the entry fields that record a Fingerprint of the
+// content at the url.
+var fingerprintFields = []string{"sha256", "etag", "size"}
+
+// Fingerprint identifies a revision of the content at a URL. Empty fields are
+// unknown.
+type Fingerprint struct {
+	SHA256 string
+	ETag   string
+	Size   string
+}
+
+// IsZero reports whether nothing is known about the content.
+func (f Fingerprint) IsZero() bool { return f == Fingerprint{} }
+
+// get returns the value of the named fingerprint field.
+func (f Fingerprint) get(name string) string {
+	switch name {
+	case "sha256":
+		return f.SHA256
+	case "etag":
+		return f.ETag
+	case "size":
+		return f.Size
+	}
+	return ""
+}
+
+// Drift compares the fingerprint with that of the live content, returning a
+// description of each known field that differs.
+func (f Fingerprint) Drift(live Fingerprint) []string {
+	var diffs []string
+	for _, name := range fingerprintFields {
+		recorded, current := f.get(name), live.get(name)
+		if recorded == "" || strings.EqualFold(recorded, current) {
+			continue
+		}
+		if current == "" {
+			current = "unknown"
+		}
+		diffs = append(diffs, fmt.Sprintf("%s is %s, recorded %s", name, current, recorded))
+	}
+	return diffs
+}
+
+// Fingerprint returns the fingerprint recorded by the sha256, etag and size
+// fields of the entry.
+func (e Entry) Fingerprint() Fingerprint {
+	return Fingerprint{
+		SHA256: e.Field("sha256"),
+		ETag:   e.Field("etag"),
+		Size:   e.Field("size"),
+	}
+}
+
+// FetchFingerprint downloads the content at the URL and returns its
+// fingerprint.
+func (c *LinkChecker) FetchFingerprint(ctx context.Context, u string) (Fingerprint, error) {
+	var f Fingerprint
+	err := c.Fetch(ctx, u, func(r *http.Response) error {
+		h := sha256.New()
+		n, err := io.Copy(h, r.Body)
+		if err != nil {
+			return err
+		}
+		f = Fingerprint{
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+			ETag:   r.Header.Get("ETag"),
+			Size:   strconv.FormatInt(n, 10),
+		}
+		return nil
+	})
+	return f, err
+}
+
+// RecordFingerprints adds fingerprint fields to entries that lack them, for
+// entries whose url has a known fingerprint. Fields that are already present
+// are not changed. Returns the keys of the entries that changed.
+func RecordFingerprints(f *BibFile, fingerprints map[string]Fingerprint) []string {
+	var keys []string
+	for _, block := range f.Blocks {
+		if block.Kind != EntryBlock {
+			continue
+		}
+
+		// Find the url and the fingerprint fields that are present.
+		link := ""
+		present := map[string]bool{}
+		for _, field := range block.Fields {
+			if field.Name == "url" && len(field.Value) == 1 && field.Value[0].Kind != MacroPart {
+				link = field.Value[0].Text
+			}
+			present[field.Name] = true
+		}
+
+		fp, ok := fingerprints[link]
+		if link == "" || !ok {
+			continue
+		}
+
+		changed := false
+		for _, name := range fingerprintFields {
+			if value := fp.get(name); value != "" && !present[name] {
+				block.Fields = append(block.Fields, Field{Name: name, Value: Value{{Kind: QuotedPart, Text: value}}})
+				changed = true
+			}
+		}
+		if changed {
+			keys = append(keys, block.Key)
+		}
+	}
+	return keys
+}
+
+// FetchFingerprints fetches the fingerprints of the links concurrently.
+// Returns the fingerprints of the links that could be fetched, and the errors
+// for those that could not.
+func (c *LinkChecker) FetchFingerprints(ctx context.Context, links []string) (map[string]Fingerprint, map[string]error) {
+	fingerprints := make([]Fingerprint, len(links))
+	errs := make([]error, len(links))
+	c.parallel(len(links), func(i int) {
+		fingerprints[i], errs[i] = c.FetchFingerprint(ctx, links[i])
+	})
+
+	found := map[string]Fingerprint{}
+	failed := map[string]error{}
+	for i, link := range links {
+		if errs[i] != nil {
+			failed[link] = errs[i]
+		} else {
+			found[link] = fingerprints[i]
+		}
+	}
+	return found, failed
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintDrift(t *testing.T) {
+	recorded := Fingerprint{
+		SHA256: "2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+		Size:   "5",
+	}
+
+	// Recorded fields match, ignoring case. Unrecorded fields are ignored.
+	live := Fingerprint{
+		SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		ETag:   `"v1"`,
+		Size:   "5",
+	}
+	if diffs := recorded.Drift(live); len(diffs) != 0 {
+		t.Fatalf("unexpected drift %v", diffs)
+	}
+
+	live = Fingerprint{SHA256: "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7", Size: "6"}
+	expect := []string{
+		"sha256 is 486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7, recorded 2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+		"size is 6, recorded 5",
+	}
+	if diffs := recorded.Drift(live); !reflect.DeepEqual(diffs, expect) {
+		t.Fatalf("got drift %v; expect %v", diffs, expect)
+	}
+
+	// Fields that cannot be determined count as drift.
+	recorded = Fingerprint{ETag: `"v1"`}
+	if diffs := recorded.Drift(Fingerprint{}); !reflect.DeepEqual(diffs, []string{`etag is unknown, recorded "v1"`}) {
+		t.Fatalf("unexpected drift %v", diffs)
+	}
+}
+
+func TestFingerprintCrossref(t *testing.T) {
+	src := `
+@inproceedings{paper,
+    title    = "Paper",
+    url      = "https://example.com/paper.pdf",
+    crossref = "proc",
+}
+
+@proceedings{proc,
+    title  = "Proceedings",
+    url    = "https://example.com/proc.pdf",
+    sha256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+    etag   = "v1",
+    size   = 5,
+}
+`
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bibliography()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fingerprint is for the parent's url, so is not inherited.
+	for _, name := range fingerprintFields {
+		if !uninherited[name] {
+			t.Errorf("fingerprint field %s is inherited through crossref", name)
+		}
+	}
+	if fp := b.Lookup("paper").Fingerprint(); !fp.IsZero() {
+		t.Errorf("paper inherited fingerprint %+v", fp)
+	}
+	if fp := b.Lookup("proc").Fingerprint(); fp.Size != "5" {
+		t.Errorf("proc fingerprint %+v; expect size 5", fp)
+	}
+}
+
+func TestFetchFingerprint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	got, err := testLinkChecker().FetchFingerprint(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Fingerprint{
+		SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		ETag:   `"v1"`,
+		Size:   "5",
+	}
+	if got != expect {
+		t.Fatalf("got %#v; expect %#v", got, expect)
+	}
+}
+
+func TestRecordFingerprints(t *testing.T) {
+	src := `@misc{new,
+    title = "New",
+    url   = "https://example.com/new",
+}
+
+@misc{recorded,
+    title  = "Recorded",
+    url    = "https://example.com/recorded",
+    sha256 = "0000",
+}
+
+@misc{unknown,
+    title = "Unknown",
+    url   = "https://example.com/unknown",
+}
+`
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := Fingerprint{SHA256: "abcd", ETag: `"v1"`, Size: "5"}
+	keys := RecordFingerprints(f, map[string]Fingerprint{
+		"https://example.com/new":      fp,
+		"https://example.com/recorded": fp,
+	})
+	if !reflect.DeepEqual(keys, []string{"new", "recorded"}) {
+		t.Fatalf("got changed keys %v", keys)
+	}
+
+	got := string(FormatBibTeX(f, DefaultFormatOptions))
+	for _, want := range []string{
+		"@misc{new,\n    title  = \"New\",\n    url    = \"https://example.com/new\",\n    etag   = {\"v1\"},\n    sha256 = \"abcd\",\n    size   = 5,\n}",
+		"    sha256 = 0000,\n    size   = 5,\n}",
+		"@misc{unknown,\n    title = \"Unknown\",\n    url   = \"https://example.com/unknown\",\n}",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatted output missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -3,16 +3,146 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
-// Format entry as a string.
-func Format(e *Entry) (string, error) {
+// Reference is the information extracted from an entry for formatting. Styles
+// are responsible for rendering a reference as text.
+type Reference struct {
+	Authors []Person
+	Title   string
+
+	// Editors and Organization stand in for the authors when there are
+	// none. See Names.
+	Editors      []Person
+	Organization string
+
+	// Details are type-specific parts of the reference, such as the venue
+	// for a conference paper. Each detail is a phrase without terminating
+	// punctuation.
+	Details []string
+
+	// Year of publication, and the full Date if known.
+	Year string
+	Date DateRange
+
+	URL      string
+	Accessed time.Time
+
+	// Mirror and Archive are alternative locations of the work, given by
+	// the mirror and archiveurl fields.
+	Mirror  string
+	Archive string
+
+	// Identifiers such as DOIs and arXiv identifiers in canonical form,
+	// excluding any that is already linked by URL.
+	Identifiers []string
+
+	// Markup used to render field values. Styles should render names with
+	// the same markup.
+	Markup Markup
+}
+
+// fieldSpec lists the fields of an entry type. Each required item may give
+// alternatives separated by "|", any one of which satisfies it.
+type fieldSpec struct {
+	Required []string
+	Optional []string
+}
+
+// entryTypes specifies the fields of each entry type supported by bib. The
+// required fields follow the BibTeX and BibLaTeX documentation, together with
+// any field that bib needs to format an entry of the type. Formatting is more
+// lenient than the specification where it can be, for example listing
+// editors in place of missing authors, while lint reports every missing
+// required field.
+var entryTypes = map[string]fieldSpec{
+	"article": {
+		Required: []string{"author", "title", "journal", "year|date"},
+		Optional: []string{"volume", "number", "pages"},
+	},
+	"book": {
+		Required: []string{"author|editor", "title", "publisher", "year|date"},
+		Optional: []string{"volume", "number", "series", "address", "edition"},
+	},
+	"booklet": {
+		Required: []string{"title"},
+		Optional: []string{"author", "howpublished", "address"},
+	},
+	"conference": {
+		Required: []string{"author", "title", "booktitle", "year|date"},
+		Optional: []string{"editor", "volume", "number", "series", "pages", "address", "organization", "publisher"},
+	},
+	"inbook": {
+		Required: []string{"author|editor", "title", "booktitle", "chapter", "year|date"},
+		Optional: []string{"publisher", "volume", "number", "series", "type", "pages", "address", "edition"},
+	},
+	"incollection": {
+		Required: []string{"author", "title", "booktitle", "publisher", "year|date"},
+		Optional: []string{"editor", "volume", "number", "series", "type", "chapter", "pages", "address", "edition"},
+	},
+	"inproceedings": {
+		Required: []string{"author", "title", "booktitle", "year|date"},
+		Optional: []string{"editor", "volume", "number", "series", "pages", "address", "organization", "publisher"},
+	},
+	"manual": {
+		Required: []string{"title"},
+		Optional: []string{"author", "organization", "address", "edition"},
+	},
+	"mastersthesis": {
+		Required: []string{"author", "title", "school", "year|date"},
+		Optional: []string{"type", "address"},
+	},
+	"misc": {
+		Required: []string{"title"},
+		Optional: []string{"author", "howpublished", "license"},
+	},
+	"online": {
+		Required: []string{"author|editor|organization", "title", "year|date", "url"},
+		Optional: []string{"subtitle", "organization"},
+	},
+	"phdthesis": {
+		Required: []string{"author", "title", "school", "year|date"},
+		Optional: []string{"type", "address"},
+	},
+	"proceedings": {
+		Required: []string{"title", "year|date"},
+		Optional: []string{"editor", "volume", "number", "series", "address", "publisher", "organization"},
+	},
+	"report": {
+		Required: []string{"author", "title", "type", "institution", "year|date"},
+		Optional: []string{"number", "address"},
+	},
+	"standard": {
+		Required: []string{"title", "organization|institution", "year|date"},
+		Optional: []string{"author", "editor", "type", "number", "publisher"},
+	},
+	"techreport": {
+		Required: []string{"author", "title", "institution", "number", "year|date"},
+		Optional: []string{"type", "address"},
+	},
+	"thesis": {
+		Required: []string{"author", "title", "type", "school|institution", "year|date"},
+		Optional: []string{"address"},
+	},
+	"unpublished": {
+		Required: []string{"author", "title", "note"},
+	},
+}
+
+// NewReference extracts reference information from the entry. Field values
+// are decoded from LaTeX and rendered with the given markup.
+func NewReference(e *Entry, m Markup) (*Reference, error) {
+	if _, ok := entryTypes[e.Type]; !ok {
+		return nil, fmt.Errorf("unknown entry type %q", e.Type)
+	}
+
 	var err error
 
 	// Helper for accessing a required field.
 	required := func(key string) string {
-		if value, found := e.Fields[key]; found {
-			return value.String()
+		if value, found := e.field(key, m); found {
+			return value
 		}
 		if err == nil {
 			err = fmt.Errorf("missing required field %q", key)
@@ -20,91 +150,267 @@ func Format(e *Entry) (string, error) {
 		return ""
 	}
 
-	// For simplicity assume author and title.
-	s := FormatAuthors(e.Authors())
-	if !strings.HasSuffix(s, ".") {
-		s += "."
+	// Helper for accessing an optional field.
+	optional := func(key string) string {
+		value, _ := e.field(key, m)
+		return value
 	}
-	s += " " + required("title") + "."
 
-	// Custom fields.
-	switch e.Type {
-	case "misc":
-		// Optional fields: author, title, howpublished, month, year, note.
-		if how, found := e.Fields["howpublished"]; found {
-			s += " " + how.String() + "."
+	// For simplicity assume title.
+	r := &Reference{
+		Authors: e.Authors(),
+		Title:   required("title"),
+		Markup:  m,
+	}
+
+	// In the absence of authors, fall back to editors and then an
+	// organization.
+	named := ""
+	if len(r.Authors) == 0 {
+		r.Editors = e.Editors()
+	}
+	if len(r.Authors) == 0 && len(r.Editors) == 0 {
+		for _, key := range []string{"organization", "institution"} {
+			if org := optional(key); org != "" {
+				r.Organization, named = org, key
+				break
+			}
 		}
+	}
 
-		if license, found := e.Fields["license"]; found {
-			s += " " + license.String() + "."
+	// Helper for accessing an organization field, which is omitted from the
+	// details if it is already listed in place of authors.
+	corporate := func(key string, get func(string) string) string {
+		value := get(key)
+		if key == named {
+			return ""
 		}
+		return value
+	}
 
-	case "inproceedings":
-		// Required fields: author, title, booktitle, year.
-		s += " In " + required("booktitle")
-		if pages, found := e.Fields["pages"]; found {
-			s += ", pages " + pages.String()
+	// Custom fields. The fields of each type are specified by entryTypes.
+	switch e.Type {
+	case "misc":
+		r.Details = append(r.Details, optional("howpublished"), optional("license"))
+
+	case "inproceedings", "conference":
+		venue := "In " + required("booktitle")
+		if pages := optional("pages"); pages != "" {
+			venue += ", pages " + pages
 		}
-		s += "."
+		r.Details = append(r.Details, venue)
 
 	case "article":
-		// Required fields: author, title, journal, year.
-		s += " " + required("journal") + "."
+		r.Details = append(r.Details, required("journal"))
 
 	case "inbook":
-		// Required fields: author or editor, title, chapter and/or pages, publisher, year.
-		s += " " + required("booktitle")
-		s += ", chapter " + required("chapter") + "."
+		r.Details = append(r.Details, required("booktitle")+", chapter "+required("chapter"))
+
+	case "book":
+		r.Details = append(r.Details,
+			series(optional("volume"), optional("number"), optional("series")),
+			edition(optional("edition")),
+			join(", ", required("publisher"), optional("address")),
+		)
+
+	case "booklet":
+		r.Details = append(r.Details, join(", ", optional("howpublished"), optional("address")))
+
+	case "manual":
+		r.Details = append(r.Details,
+			edition(optional("edition")),
+			join(", ", corporate("organization", optional), optional("address")),
+		)
+
+	case "proceedings":
+		r.Details = append(r.Details,
+			series(optional("volume"), optional("number"), optional("series")),
+			join(", ", optional("publisher"), corporate("organization", optional), optional("address")),
+		)
+
+	case "incollection":
+		venue := "In " + required("booktitle")
+		if chapter := optional("chapter"); chapter != "" {
+			venue += ", chapter " + chapter
+		}
+		if pages := optional("pages"); pages != "" {
+			venue += ", pages " + pages
+		}
+		r.Details = append(r.Details,
+			venue,
+			series(optional("volume"), optional("number"), optional("series")),
+			edition(optional("edition")),
+			join(", ", required("publisher"), optional("address")),
+		)
+
+	case "unpublished":
+		r.Details = append(r.Details, required("note"))
 
 	case "phdthesis":
-		// Required fields: author, title, school, year.
-		s += " PhD thesis, " + required("school") + "."
+		r.Details = append(r.Details, "PhD thesis, "+required("school"))
 
 	case "mastersthesis":
-		// Required fields: author, title, school, year.
-		s += " Masters thesis, " + required("school") + "."
+		r.Details = append(r.Details, "Masters thesis, "+required("school"))
 
 	case "techreport":
-		// Required fields: author, title, institution, year.
-		// Optional fields: type, number, address, month, note.
-		s += " Technical Report " + required("number")
-		s += ", " + required("institution") + "."
+		r.Details = append(r.Details, join(", ", "Technical Report "+required("number"), corporate("institution", required)))
+
+	case "online":
+		required("url")
+		r.Details = append(r.Details, corporate("organization", optional))
+
+	case "report":
+		r.Details = append(r.Details, join(", ",
+			join(" ", typename(required("type")), optional("number")),
+			corporate("institution", required),
+		))
+
+	case "thesis":
+		institution := optional("school")
+		if institution == "" {
+			institution = corporate("institution", required)
+		}
+		r.Details = append(r.Details, join(", ", typename(required("type")), institution))
+
+	case "standard":
+		r.Details = append(r.Details,
+			join(" ", optional("type"), optional("number")),
+			join(", ", corporate("organization", optional), corporate("institution", optional), optional("publisher")),
+		)
 
 	default:
-		return "", fmt.Errorf("unknown entry type %q", e.Type)
+		return nil, fmt.Errorf("unknown entry type %q", e.Type)
 	}
 
 	// Look for a date.
-	if year, found := e.Fields["year"]; found {
-		s += " " + year.String() + "."
+	r.Date = e.Date()
+	r.Year = optional("year")
+	if r.Year == "" {
+		r.Year = r.Date.Year()
+	}
+
+	// Always look for a URL. In its absence, link to the first identifier
+	// that has a resolver.
+	url := e.Field("url")
+	for _, id := range e.Identifiers() {
+		switch link := id.URL(); {
+		case link != "" && link == url:
+		case link != "" && url == "":
+			url = link
+		default:
+			r.Identifiers = append(r.Identifiers, m.Text(id.String()))
+		}
+	}
+	if url != "" {
+		r.URL = m.Text(url)
 	}
 
-	// Always look for a URL.
-	if url, found := e.Fields["url"]; found {
-		s += " " + url.String()
+	if mirror := e.Field("mirror"); mirror != "" {
+		r.Mirror = m.Text(mirror)
+	}
+	if archive := e.Field("archiveurl"); archive != "" {
+		r.Archive = m.Text(archive)
 	}
 
 	if accessed, err := e.DateField("urldate"); err == nil {
-		s += " (accessed " + accessed.Format("January 2, 2006") + ")"
+		r.Accessed = accessed
 	}
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return s, nil
+
+	r.Details = nonempty(r.Details)
+
+	return r, nil
 }
 
-// FormatAuthors formats a list of authors in a readable form.
-func FormatAuthors(authors []string) string {
-	n := len(authors)
-	switch n {
-	case 0:
-		return ""
-	case 1:
-		return authors[0]
+// Names formats the names the reference is listed under: the authors, or
+// failing that the editors or organization. Returns the empty string if there
+// are none of these, in which case styles lead with the title.
+func (r *Reference) Names(f NameFormat) string {
+	switch {
+	case len(r.Authors) > 0:
+		return FormatAuthors(r.Authors, f, r.Markup)
+	case len(r.Editors) == 1:
+		return FormatAuthors(r.Editors, f, r.Markup) + ", ed."
+	case len(r.Editors) > 1:
+		return FormatAuthors(r.Editors, f, r.Markup) + ", eds."
+	}
+	return r.Organization
+}
+
+// nonempty returns the non-empty strings in the list.
+func nonempty(strs []string) []string {
+	var result []string
+	for _, s := range strs {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// join the non-empty strings with the separator.
+func join(sep string, strs ...string) string {
+	return strings.Join(nonempty(strs), sep)
+}
+
+// series describes the position of a book in a series.
+func series(volume, number, name string) string {
+	switch {
+	case volume != "" && name != "":
+		return "Volume " + volume + " of " + name
+	case volume != "":
+		return "Volume " + volume
+	case number != "" && name != "":
+		return "Number " + number + " in " + name
 	default:
-		return strings.Join(authors[:n-1], ", ") + " and " + authors[n-1]
+		return name
+	}
+}
+
+// edition describes an edition of a book, such as "Second edition".
+func edition(e string) string {
+	if e == "" {
+		return ""
+	}
+	return e + " edition"
+}
+
+// typenames maps BibLaTeX localization keys for report and thesis types to
+// readable names.
+var typenames = map[string]string{
+	"mathesis":   "Masters thesis",
+	"phdthesis":  "PhD thesis",
+	"candthesis": "Candidate thesis",
+	"techreport": "Technical Report",
+	"resreport":  "Research Report",
+	"software":   "Computer software",
+	"datacd":     "Data CD",
+	"audiocd":    "Audio CD",
+}
+
+// typename returns a readable name for the type field of a report or thesis.
+func typename(t string) string {
+	if name, ok := typenames[strings.ToLower(t)]; ok {
+		return name
+	}
+	return t
+}
+
+// Format entry as plain text in the default style.
+func Format(e *Entry) (string, error) {
+	return FormatStyle(e, DefaultStyle, PlainText)
+}
+
+// FormatStyle formats the entry in the given style and markup.
+func FormatStyle(e *Entry, style Style, m Markup) (string, error) {
+	r, err := NewReference(e, m)
+	if err != nil {
+		return "", err
 	}
+	return style.Format(r), nil
 }
 
 // Wrap text into lines of length at most width.
@@ -20,7 +20,7 @@ func (t TestEntry) Entry() *Entry {
 	for name, value := range t.Fields {
 		e.AddField(name, bibtex.BibConst(value))
 	}
-	return &Entry{*e}
+	return &Entry{BibEntry: *e}
 }
 
 func TestFormat(t *testing.T) {
@@ -98,7 +98,7 @@ func TestFormat(t *testing.T) {
 					"pages":     "42--78",
 				},
 			},
-			Expect: "First Author. Title. In Handbook of Golang, pages 42--78.",
+			Expect: "First Author. Title. In Handbook of Golang, pages 42–78.",
 		},
 		{
 			TestEntry: TestEntry{
@@ -167,6 +167,297 @@ func TestFormat(t *testing.T) {
 			},
 			Expect: "First Author. Title. Technical Report TPS-142, Initech. 1973.",
 		},
+		{
+			TestEntry: TestEntry{
+				Name: "conference",
+				Type: "conference",
+				Fields: map[string]string{
+					"author":    "First Author",
+					"title":     "Title",
+					"booktitle": "GopherCon",
+					"year":      "2019",
+				},
+			},
+			Expect: "First Author. Title. In GopherCon. 2019.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "book",
+				Type: "book",
+				Fields: map[string]string{
+					"author":    "First Author",
+					"title":     "Title",
+					"publisher": "Addison-Wesley",
+					"address":   "Boston",
+					"volume":    "2",
+					"series":    "The Art of Programming",
+					"edition":   "Third",
+					"year":      "1997",
+				},
+			},
+			Expect: "First Author. Title. Volume 2 of The Art of Programming. Third edition. Addison-Wesley, Boston. 1997.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "booklet",
+				Type: "booklet",
+				Fields: map[string]string{
+					"author":       "First Author",
+					"title":        "Title",
+					"howpublished": "Handed out at GopherCon",
+				},
+			},
+			Expect: "First Author. Title. Handed out at GopherCon.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "manual",
+				Type: "manual",
+				Fields: map[string]string{
+					"author":       "First Author",
+					"title":        "Title",
+					"organization": "The Go Authors",
+					"edition":      "Second",
+					"year":         "2012",
+				},
+			},
+			Expect: "First Author. Title. Second edition. The Go Authors. 2012.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "proceedings",
+				Type: "proceedings",
+				Fields: map[string]string{
+					"author":    "First Author",
+					"title":     "Title",
+					"number":    "1234",
+					"series":    "Lecture Notes in Computer Science",
+					"publisher": "Springer",
+					"year":      "2019",
+				},
+			},
+			Expect: "First Author. Title. Number 1234 in Lecture Notes in Computer Science. Springer. 2019.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "incollection",
+				Type: "incollection",
+				Fields: map[string]string{
+					"author":    "First Author",
+					"title":     "Title",
+					"booktitle": "Collected Works",
+					"chapter":   "3",
+					"pages":     "10--20",
+					"publisher": "Gopher Press",
+					"year":      "2015",
+				},
+			},
+			Expect: "First Author. Title. In Collected Works, chapter 3, pages 10–20. Gopher Press. 2015.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "unpublished",
+				Type: "unpublished",
+				Fields: map[string]string{
+					"author": "First Author",
+					"title":  "Title",
+					"note":   "Draft manuscript",
+				},
+			},
+			Expect: "First Author. Title. Draft manuscript.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "online",
+				Type: "online",
+				Fields: map[string]string{
+					"author":       "First Author",
+					"title":        "Title",
+					"organization": "The Go Authors",
+					"url":          "https://golang.org",
+					"year":         "2020",
+				},
+			},
+			Expect: "First Author. Title. The Go Authors. 2020. https://golang.org",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "report",
+				Type: "report",
+				Fields: map[string]string{
+					"author":      "First Author",
+					"title":       "Title",
+					"type":        "techreport",
+					"number":      "TPS-142",
+					"institution": "Initech",
+					"year":        "1973",
+				},
+			},
+			Expect: "First Author. Title. Technical Report TPS-142, Initech. 1973.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "thesis",
+				Type: "thesis",
+				Fields: map[string]string{
+					"author":      "First Author",
+					"title":       "Title",
+					"type":        "phdthesis",
+					"institution": "University of Bristol",
+					"year":        "2001",
+				},
+			},
+			Expect: "First Author. Title. PhD thesis, University of Bristol. 2001.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "standard",
+				Type: "standard",
+				Fields: map[string]string{
+					"author":       "NIST",
+					"title":        "Digital Signature Standard (DSS)",
+					"type":         "FIPS PUB",
+					"number":       "186-4",
+					"organization": "National Institute of Standards and Technology",
+					"year":         "2013",
+				},
+			},
+			Expect: "NIST. Digital Signature Standard (DSS). FIPS PUB 186-4. National Institute of Standards and Technology. 2013.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "editor",
+				Type: "book",
+				Fields: map[string]string{
+					"editor":    "First Editor",
+					"title":     "Title",
+					"publisher": "Gopher Press",
+					"year":      "2015",
+				},
+			},
+			Expect: "First Editor, ed. Title. Gopher Press. 2015.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "editors",
+				Type: "proceedings",
+				Fields: map[string]string{
+					"editor":       "Editor, First and Second Editor",
+					"title":        "Title",
+					"organization": "The Go Authors",
+					"year":         "2019",
+				},
+			},
+			Expect: "First Editor and Second Editor, eds. Title. The Go Authors. 2019.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "organization",
+				Type: "standard",
+				Fields: map[string]string{
+					"title":        "Digital Signature Standard (DSS)",
+					"type":         "FIPS PUB",
+					"number":       "186-4",
+					"organization": "National Institute of Standards and Technology",
+					"year":         "2013",
+				},
+			},
+			Expect: "National Institute of Standards and Technology. Digital Signature Standard (DSS). FIPS PUB 186-4. 2013.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "institution",
+				Type: "techreport",
+				Fields: map[string]string{
+					"title":       "Title",
+					"number":      "TPS-142",
+					"institution": "Initech",
+					"year":        "1973",
+				},
+			},
+			Expect: "Initech. Title. Technical Report TPS-142. 1973.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "title_first",
+				Type: "misc",
+				Fields: map[string]string{
+					"title":        "Title",
+					"howpublished": "Handed out at GopherCon",
+					"year":         "2019",
+				},
+			},
+			Expect: "Title. Handed out at GopherCon. 2019.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "month",
+				Type: "misc",
+				Fields: map[string]string{
+					"author": "First Author",
+					"title":  "Title",
+					"month":  "February",
+					"year":   "2020",
+				},
+			},
+			Expect: "First Author. Title. February 2020.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "date",
+				Type: "misc",
+				Fields: map[string]string{
+					"author": "First Author",
+					"title":  "Title",
+					"date":   "2020-03-05/2020-03-07",
+				},
+			},
+			Expect: "First Author. Title. March 5–7, 2020.",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "doi",
+				Type: "article",
+				Fields: map[string]string{
+					"author":  "First Author",
+					"title":   "Title",
+					"journal": "Journal of Computer Science",
+					"doi":     "10.1000/182",
+					"year":    "1997",
+				},
+			},
+			Expect: "First Author. Title. Journal of Computer Science. 1997. https://doi.org/10.1000/182",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "identifiers",
+				Type: "misc",
+				Fields: map[string]string{
+					"author":        "First Author",
+					"title":         "Title",
+					"url":           "https://golang.org",
+					"eprint":        "2101.00001",
+					"archiveprefix": "arXiv",
+					"doi":           "10.1000/182",
+				},
+			},
+			Expect: "First Author. Title. https://golang.org https://doi.org/10.1000/182 arXiv:2101.00001",
+		},
+		{
+			TestEntry: TestEntry{
+				Name: "archive",
+				Type: "misc",
+				Fields: map[string]string{
+					"author":     "First Author",
+					"title":      "Title",
+					"url":        "https://example.com/guide.pdf",
+					"mirror":     "https://mirror.example.org/guide.pdf",
+					"archiveurl": "https://web.archive.org/web/2020/https://example.com/guide.pdf",
+					"urldate":    "2020-03-05",
+				},
+			},
+			Expect: "First Author. Title. https://example.com/guide.pdf (accessed March 5, 2020) (mirror: https://mirror.example.org/guide.pdf) (archived: https://web.archive.org/web/2020/https://example.com/guide.pdf)",
+		},
 	}
 	for _, c := range cases {
 		c := c // scopelint
@@ -219,12 +510,65 @@ func TestFormatRequiredFields(t *testing.T) {
 			Type:     "techreport",
 			Required: []string{"title", "institution", "number"},
 		},
+		{
+			Type:     "conference",
+			Required: []string{"title", "booktitle"},
+		},
+		{
+			Type:     "book",
+			Required: []string{"title", "publisher"},
+		},
+		{
+			Type:     "booklet",
+			Required: []string{"title"},
+		},
+		{
+			Type:     "manual",
+			Required: []string{"title"},
+		},
+		{
+			Type:     "proceedings",
+			Required: []string{"title"},
+		},
+		{
+			Type:     "incollection",
+			Required: []string{"title", "booktitle", "publisher"},
+		},
+		{
+			Type:     "unpublished",
+			Required: []string{"title", "note"},
+		},
+		{
+			Type:     "online",
+			Required: []string{"title", "url"},
+		},
+		{
+			Type:     "report",
+			Required: []string{"title", "type", "institution"},
+		},
+		{
+			Type:     "thesis",
+			Required: []string{"title", "type", "institution"},
+		},
+		{
+			Type:     "standard",
+			Required: []string{"title"},
+		},
 	}
 	for _, c := range cases {
 		c := c // scopelint
 		for _, required := range c.Required {
 			required := required // scopelint
 			t.Run(c.Type+"_"+required, func(t *testing.T) {
+				// The field must be required by the entry type specification.
+				specified := false
+				for _, item := range entryTypes[c.Type].Required {
+					specified = specified || contains(strings.Split(item, "|"), required)
+				}
+				if !specified {
+					t.Errorf("%s is not required by the %s specification", required, c.Type)
+				}
+
 				// Build an entry with all required fields except this one.
 				e := TestEntry{
 					Name:   required,
@@ -253,6 +597,28 @@ func TestFormatRequiredFields(t *testing.T) {
 	}
 }
 
+func TestFormatEntryTypes(t *testing.T) {
+	// Every specified entry type is formatted given its required fields,
+	// using any of the alternatives, and formatting requires no other field.
+	for typ, spec := range entryTypes {
+		for i, item := range spec.Required {
+			for _, alternative := range strings.Split(item, "|") {
+				e := TestEntry{Name: alternative, Type: typ, Fields: map[string]string{}}
+				for j, other := range spec.Required {
+					name := strings.Split(other, "|")[0]
+					if j == i {
+						name = alternative
+					}
+					e.Fields[name] = name
+				}
+				if _, err := Format(e.Entry()); err != nil {
+					t.Errorf("%s with %s: %s", typ, alternative, err)
+				}
+			}
+		}
+	}
+}
+
 func TestFormatUnknownType(t *testing.T) {
 	e := TestEntry{
 		Name:   "unknowntype",
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxFragmentContent is the limit on the size of content downloaded to check
+// a fragment.
+const maxFragmentContent = 64 << 20
+
+// CheckFragment verifies that the fragment of the URL exists in its content.
+// In an HTML document the fragment must be the id or name of an element. In a
+// PDF document a "page=N" parameter must not exceed the number of pages.
+// Fragments of other content, and URLs without a fragment, are not checked.
+func (c *LinkChecker) CheckFragment(ctx context.Context, u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Fragment == "" {
+		return nil
+	}
+
+	return c.Fetch(ctx, u, func(r *http.Response) error {
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxFragmentContent))
+		if err != nil {
+			return err
+		}
+
+		switch contentType(r.Header.Get("Content-Type"), data) {
+		case "text/html", "application/xhtml+xml":
+			return checkHTMLFragment(data, parsed.Fragment)
+		case "application/pdf":
+			return checkPDFFragment(data, parsed.Fragment)
+		}
+		return nil
+	})
+}
+
+// contentType returns the media type of content, from the Content-Type header
+// if present or else by sniffing the data.
+func contentType(header string, data []byte) string {
+	if typ, _, err := mime.ParseMediaType(header); err == nil && typ != "application/octet-stream" {
+		return typ
+	}
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "application/pdf"
+	}
+	typ, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return typ
+}
+
+// checkHTMLFragment checks that the fragment is the id or name of an element
+// in the HTML document.
+func checkHTMLFragment(data []byte, fragment string) error {
+	anchors := htmlAnchors(data)
+	if anchors[fragment] {
+		return nil
+	}
+	return fmt.Errorf("fragment %q not found", fragment)
+}
+
+var (
+	// htmlTag matches an HTML start tag, capturing its name and attributes.
+	htmlTag = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9-]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'>]+))?)*)\s*/?>`)
+
+	// htmlAttr matches an attribute, capturing its name and value.
+	htmlAttr = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+
+	// htmlSkipped matches comments, and script and style elements, which
+	// do not contain anchors.
+	htmlSkipped = regexp.MustCompile(`(?is)<!--.*?-->|<script\b.*?</script\s*>|<style\b.*?</style\s*>`)
+)
+
+// htmlAnchors returns the values of the id and name attributes in an HTML
+// document.
+func htmlAnchors(data []byte) map[string]bool {
+	anchors := map[string]bool{}
+	data = htmlSkipped.ReplaceAll(data, nil)
+	for _, tag := range htmlTag.FindAllSubmatch(data, -1) {
+		for _, attr := range htmlAttr.FindAllSubmatch(tag[2], -1) {
+			name := strings.ToLower(string(attr[1]))
+			if name != "id" && name != "name" {
+				continue
+			}
+			value := string(attr[2]) + string(attr[3]) + string(attr[4])
+			anchors[html.UnescapeString(value)] = true
+		}
+	}
+	return anchors
+}
+
+// checkPDFFragment checks that a "page=N" parameter of the fragment does not
+// exceed the number of pages of the PDF document. Other parameters, such as
+// named destinations, are not checked, and nor are documents whose page count
+// cannot be determined.
+func checkPDFFragment(data []byte, fragment string) error {
+	for _, param := range strings.Split(fragment, "&") {
+		if !strings.HasPrefix(param, "page=") {
+			continue
+		}
+
+		page, err := strconv.Atoi(strings.TrimPrefix(param, "page="))
+		if err != nil || page < 1 {
+			return fmt.Errorf("invalid page in fragment %q", fragment)
+		}
+
+		if count, err := pdfPageCount(data); err == nil && page > count {
+			return fmt.Errorf("page %d exceeds page count %d", page, count)
+		}
+	}
+	return nil
+}
+
+var (
+	// pdfPages matches the type of a node of the PDF page tree.
+	pdfPages = regexp.MustCompile(`/Type\s*/Pages\b`)
+
+	// pdfCount matches the number of pages below a page tree node.
+	pdfCount = regexp.MustCompile(`/Count\s+(\d+)`)
+
+	// pdfStream matches the start of a stream.
+	pdfStream = regexp.MustCompile(`stream\r?\n`)
+)
+
+// pdfPageCount returns the number of pages in a PDF document. This is the
+// largest count of the page tree nodes, which may be in compressed object
+// streams. Streams are only decompressed, one at a time, if the page tree is
+// not found in the document itself.
+func pdfPageCount(data []byte) (int, error) {
+	if count := pdfPageTreeCount(data); count > 0 {
+		return count, nil
+	}
+
+	for _, loc := range pdfStream.FindAllIndex(data, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(data[loc[1]:]))
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadAll(io.LimitReader(r, maxFragmentContent))
+		if err != nil && len(content) == 0 {
+			continue
+		}
+		if count := pdfPageTreeCount(content); count > 0 {
+			return count, nil
+		}
+	}
+
+	return 0, errors.New("could not determine pdf page count")
+}
+
+// pdfPageTreeCount returns the largest count of the page tree nodes in a
+// section of a PDF document, or zero if there are none.
+func pdfPageTreeCount(section []byte) int {
+	count := 0
+	for _, loc := range pdfPages.FindAllIndex(section, -1) {
+		// Look for the count in the enclosing dictionary.
+		start := bytes.LastIndex(section[:loc[0]], []byte("<<"))
+		end := bytes.Index(section[loc[1]:], []byte(">>"))
+		if start < 0 || end < 0 {
+			continue
+		}
+		m := pdfCount.FindSubmatch(section[start : loc[1]+end])
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n > count {
+			count = n
+		}
+	}
+	return count
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHTMLAnchors(t *testing.T) {
+	src := `<!DOCTYPE html>
+<html>
+<head><style>#hidden { }</style></head>
+<body>
+<h2 id="section-4.2">Section</h2>
+<a name='legacy'>Legacy</a>
+<div ID=unquoted class="x">Unquoted</div>
+<span data-id="other" id="a&amp;b"></span>
+<!-- <p id="commented"></p> -->
+<script>var s = '<p id="scripted">';</script>
+<img id="self" src="x.png"/>
+</body>
+</html>
+`
+	got := htmlAnchors([]byte(src))
+	expect := map[string]bool{
+		"section-4.2": true,
+		"legacy":      true,
+		"unquoted":    true,
+		"a&b":         true,
+		"self":        true,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v; expect %v", got, expect)
+	}
+}
+
+// testPDF builds a minimal PDF document with the given number of pages. If
+// compressed, the page tree is stored in a compressed object stream.
+func testPDF(t *testing.T, pages int, compressed bool) []byte {
+	t.Helper()
+
+	tree := "<< /Kids [3 0 R] /Type /Pages /Count " + strconv.Itoa(pages) + " >>"
+	outline := "<< /Type /Outlines /Count 9 >>"
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R /Outlines 4 0 R >>\nendobj\n")
+	buf.WriteString("4 0 obj\n" + outline + "\nendobj\n")
+	if !compressed {
+		buf.WriteString("2 0 obj\n" + tree + "\nendobj\n")
+	} else {
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		// Pad the stream so that it is compressed rather than stored.
+		if _, err := w.Write([]byte("2 0 " + tree + strings.Repeat(" ", 256))); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString("5 0 obj\n<< /Type /ObjStm /Filter /FlateDecode >>\nstream\n")
+		buf.Write(z.Bytes())
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+	buf.WriteString("%%EOF\n")
+	return buf.Bytes()
+}
+
+func TestPDFPageCount(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		got, err := pdfPageCount(testPDF(t, 3, compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 3 {
+			t.Errorf("compressed=%v: got %d pages; expect 3", compressed, got)
+		}
+	}
+
+	// Streams are not decompressed when the page tree is not compressed.
+	mixed := append(testPDF(t, 3, false), testPDF(t, 9, true)...)
+	if got, err := pdfPageCount(mixed); err != nil || got != 3 {
+		t.Errorf("got %d pages, error %v; expect 3 pages from the uncompressed page tree", got, err)
+	}
+
+	if _, err := pdfPageCount([]byte("%PDF-1.4\n%%EOF\n")); err == nil {
+		t.Error("expected error for pdf without page tree")
+	}
+}
+
+func TestCheckFragment(t *testing.T) {
+	pdf := testPDF(t, 3, true)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rfc.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body><h2 id="section-4.2">4.2</h2></body></html>`))
+	})
+	mux.HandleFunc("/spec.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(pdf)
+	})
+	mux.HandleFunc("/encrypted.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4\n%%EOF\n"))
+	})
+	mux.HandleFunc("/notes.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("notes"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cases := map[string]string{
+		"/rfc.html":                 "",
+		"/rfc.html#section-4.2":     "",
+		"/rfc.html#section-4.3":     `fragment "section-4.3" not found`,
+		"/spec.pdf#page=3":          "",
+		"/spec.pdf#page=3&zoom=100": "",
+		"/spec.pdf#page=4":          "page 4 exceeds page count 3",
+		"/spec.pdf#page=zero":       `invalid page in fragment "page=zero"`,
+		"/spec.pdf#nameddest=intro": "",
+		"/encrypted.pdf#page=2":     "",
+		"/notes.txt#anything":       "",
+	}
+
+	c := testLinkChecker()
+	c.Fragments = true
+	for path, expect := range cases {
+		got := ""
+		if err := c.CheckLink(context.Background(), srv.URL+path); err != nil {
+			got = err.Error()
+		}
+		if got != expect {
+			t.Errorf("%s: got error %q; expect %q", path, got, expect)
+		}
+	}
+}
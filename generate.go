@@ -10,18 +10,22 @@ import (
 //go:generate assets -d templates -o ztemplates.go -map templates
 
 // Generate templated output from the given bibliography and writes to w.
-func Generate(w io.Writer, tmpl string, b *Bibliography) error {
+// Entries are formatted in the given style.
+func Generate(w io.Writer, tmpl string, b *Bibliography, style Style) error {
 	// Parse template.
 	t, err := template.New("").Parse(tmpl)
 	if err != nil {
 		return err
 	}
 
-	// Prepare template data.
+	// Prepare template data. Formatted entries are provided as plain text,
+	// markdown and HTML.
 	type entry struct {
 		Entry
 
 		Formatted string
+		Markdown  string
+		HTML      string
 	}
 	type data struct {
 		Entries []entry
@@ -29,13 +33,23 @@ func Generate(w io.Writer, tmpl string, b *Bibliography) error {
 	d := data{}
 
 	for _, e := range b.Entries {
-		f, err := Format(e)
+		f, err := FormatStyle(e, style, PlainText)
+		if err != nil {
+			return err
+		}
+		md, err := FormatStyle(e, style, Markdown)
+		if err != nil {
+			return err
+		}
+		h, err := FormatStyle(e, style, HTML)
 		if err != nil {
 			return err
 		}
 		d.Entries = append(d.Entries, entry{
 			Entry:     *e,
 			Formatted: f,
+			Markdown:  md,
+			HTML:      h,
 		})
 	}
 
@@ -5,5 +5,6 @@ go 1.13
 require (
 	github.com/google/subcommands v1.2.0
 	github.com/nickng/bibtex v1.2.0
+	github.com/pkg/diff v0.0.0-20210226163009-20ebb0f2a09e
 	github.com/rogpeppe/go-internal v1.9.1-0.20230209130841-f0583b8402aa
 )
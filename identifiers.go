@@ -0,0 +1,131 @@
+package main
+
+import "strings"
+
+// Identifier is a persistent identifier for a work, such as a DOI or arXiv
+// identifier.
+type Identifier struct {
+	// Type of identifier: "doi", "isbn", "issn", or the type of eprint such
+	// as "arxiv".
+	Type string
+
+	// Value of the identifier in canonical form, without any prefix.
+	Value string
+
+	// Class is the subject class of an eprint, if known.
+	Class string
+}
+
+// String returns the identifier in its canonical display form, for example
+// "https://doi.org/10.1000/182" or "arXiv:2101.00001".
+func (id Identifier) String() string {
+	switch id.Type {
+	case "doi":
+		return id.URL()
+	case "arxiv":
+		if id.Class != "" {
+			return "arXiv:" + id.Value + " [" + id.Class + "]"
+		}
+		return "arXiv:" + id.Value
+	case "isbn":
+		return "ISBN " + id.Value
+	case "issn":
+		return "ISSN " + id.Value
+	case "hdl":
+		return "hdl:" + id.Value
+	case "pubmed":
+		return "PMID " + id.Value
+	case "jstor":
+		return "JSTOR " + id.Value
+	case "iacr":
+		return "Cryptology ePrint Archive, Report " + id.Value
+	case "":
+		return id.Value
+	}
+	return id.Type + ":" + id.Value
+}
+
+// URL returns a link to the identified work, or the empty string if the
+// identifier has no standard resolver.
+func (id Identifier) URL() string {
+	switch id.Type {
+	case "doi":
+		return "https://doi.org/" + id.Value
+	case "arxiv":
+		return "https://arxiv.org/abs/" + id.Value
+	case "hdl":
+		return "https://hdl.handle.net/" + id.Value
+	case "pubmed":
+		return "https://pubmed.ncbi.nlm.nih.gov/" + id.Value + "/"
+	case "jstor":
+		return "https://www.jstor.org/stable/" + id.Value
+	case "iacr":
+		return "https://eprint.iacr.org/" + id.Value
+	}
+	return ""
+}
+
+// Identifiers returns the persistent identifiers given by the doi, eprint,
+// isbn and issn fields of the entry. The type of eprint is taken from the
+// BibLaTeX eprinttype field, or the archiveprefix field used by arXiv.
+func (e Entry) Identifiers() []Identifier {
+	var ids []Identifier
+
+	if doi := e.Field("doi"); doi != "" {
+		ids = append(ids, Identifier{Type: "doi", Value: trimPrefixes(doi,
+			"https://doi.org/", "http://doi.org/",
+			"https://dx.doi.org/", "http://dx.doi.org/",
+			"doi:",
+		)})
+	}
+
+	if eprint := e.Field("eprint"); eprint != "" {
+		typ := e.Field("eprinttype")
+		if typ == "" {
+			typ = e.Field("archiveprefix")
+		}
+		typ = strings.ToLower(typ)
+
+		class := e.Field("eprintclass")
+		if class == "" {
+			class = e.Field("primaryclass")
+		}
+
+		value := eprint
+		switch typ {
+		case "arxiv":
+			value = trimPrefixes(eprint, "https://arxiv.org/abs/", "http://arxiv.org/abs/", "arxiv:")
+		case "handle":
+			typ = "hdl"
+		case "pmid":
+			typ = "pubmed"
+		}
+		ids = append(ids, Identifier{Type: typ, Value: value, Class: class})
+	}
+
+	if isbn := e.Field("isbn"); isbn != "" {
+		ids = append(ids, Identifier{Type: "isbn", Value: strings.ToUpper(trimPrefixes(isbn, "isbn-13:", "isbn-10:", "isbn:", "isbn"))})
+	}
+
+	if issn := e.Field("issn"); issn != "" {
+		value := strings.ToUpper(trimPrefixes(issn, "issn:", "issn"))
+		if len(value) == 8 && !strings.Contains(value, "-") {
+			value = value[:4] + "-" + value[4:]
+		}
+		ids = append(ids, Identifier{Type: "issn", Value: value})
+	}
+
+	return ids
+}
+
+// trimPrefixes removes the first of the given prefixes that s starts with,
+// ignoring case, and surrounding whitespace.
+func trimPrefixes(s string, prefixes ...string) string {
+	s = strings.TrimSpace(s)
+	for _, prefix := range prefixes {
+		if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+			return strings.TrimSpace(s[len(prefix):])
+		}
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIdentifiers(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Fields map[string]string
+		String string
+		URL    string
+	}{
+		{"doi", map[string]string{"doi": "10.1007/3-540-46885-4_5"}, "https://doi.org/10.1007/3-540-46885-4_5", "https://doi.org/10.1007/3-540-46885-4_5"},
+		{"doi_prefix", map[string]string{"doi": "doi:10.1007/x"}, "https://doi.org/10.1007/x", "https://doi.org/10.1007/x"},
+		{"doi_url", map[string]string{"doi": "http://dx.doi.org/10.1007/x"}, "https://doi.org/10.1007/x", "https://doi.org/10.1007/x"},
+		{"eprinttype", map[string]string{"eprint": "2101.00001", "eprinttype": "arxiv"}, "arXiv:2101.00001", "https://arxiv.org/abs/2101.00001"},
+		{"archiveprefix", map[string]string{"eprint": "arXiv:2101.00001", "archiveprefix": "arXiv", "primaryclass": "cs.CR"}, "arXiv:2101.00001 [cs.CR]", "https://arxiv.org/abs/2101.00001"},
+		{"iacr", map[string]string{"eprint": "2013/647", "eprinttype": "iacr"}, "Cryptology ePrint Archive, Report 2013/647", "https://eprint.iacr.org/2013/647"},
+		{"handle", map[string]string{"eprint": "1721.1/12345", "eprinttype": "handle"}, "hdl:1721.1/12345", "https://hdl.handle.net/1721.1/12345"},
+		{"unknown", map[string]string{"eprint": "123", "eprinttype": "example"}, "example:123", ""},
+		{"isbn", map[string]string{"isbn": "ISBN-13: 978-0-201-89683-1"}, "ISBN 978-0-201-89683-1", ""},
+		{"issn", map[string]string{"issn": "0378475x"}, "ISSN 0378-475X", ""},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			ids := TestEntry{Type: "misc", Name: c.Name, Fields: c.Fields}.Entry().Identifiers()
+			if len(ids) != 1 {
+				t.Fatalf("got %d identifiers; expect 1", len(ids))
+			}
+			if got := ids[0].String(); got != c.String {
+				t.Errorf("String() = %q; expect %q", got, c.String)
+			}
+			if got := ids[0].URL(); got != c.URL {
+				t.Errorf("URL() = %q; expect %q", got, c.URL)
+			}
+		})
+	}
+}
+
+func TestLinksIdentifiers(t *testing.T) {
+	b := &Bibliography{
+		Entries: []*Entry{
+			TestEntry{Type: "misc", Name: "a", Fields: map[string]string{
+				"url": "https://golang.org",
+				"doi": "10.1000/182",
+			}}.Entry(),
+			TestEntry{Type: "misc", Name: "b", Fields: map[string]string{
+				"url":    "https://arxiv.org/abs/2101.00001",
+				"eprint": "2101.00001", "eprinttype": "arxiv",
+				"isbn": "978-0-201-89683-1",
+			}}.Entry(),
+		},
+	}
+	expect := []string{
+		"https://golang.org",
+		"https://doi.org/10.1000/182",
+		"https://arxiv.org/abs/2101.00001",
+	}
+	if got := Links(b); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v; expect %v", got, expect)
+	}
+}
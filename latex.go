@@ -0,0 +1,426 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Markup renders text decoded from LaTeX in an output format.
+type Markup interface {
+	// Text escapes literal text.
+	Text(s string) string
+
+	// Emph, Strong and Code apply formatting to already rendered text.
+	Emph(s string) string
+	Strong(s string) string
+	Code(s string) string
+
+	// Link to url with rendered link text.
+	Link(url, text string) string
+}
+
+// Builtin markup formats.
+var (
+	PlainText Markup = plaintext{}
+	Markdown  Markup = markdown{}
+	HTML      Markup = htmlmarkup{}
+)
+
+type plaintext struct{}
+
+func (plaintext) Text(s string) string   { return s }
+func (plaintext) Emph(s string) string   { return s }
+func (plaintext) Strong(s string) string { return s }
+func (plaintext) Code(s string) string   { return s }
+
+func (plaintext) Link(url, text string) string {
+	if text == url {
+		return url
+	}
+	return text + " (" + url + ")"
+}
+
+type markdown struct{}
+
+// Replacers to escape Markdown metacharacters in text, and to undo it inside
+// code spans where backslash escapes are not recognized.
+var (
+	markdownEscaper   = strings.NewReplacer(`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`)
+	markdownUnescaper = strings.NewReplacer(`\\`, `\`, "\\`", "`", `\*`, `*`, `\_`, `_`, `\[`, `[`, `\]`, `]`, `\<`, `<`, `\>`, `>`)
+)
+
+func (markdown) Text(s string) string   { return markdownEscaper.Replace(s) }
+func (markdown) Emph(s string) string   { return "*" + s + "*" }
+func (markdown) Strong(s string) string { return "**" + s + "**" }
+func (markdown) Code(s string) string   { return "`" + markdownUnescaper.Replace(s) + "`" }
+
+func (m markdown) Link(url, text string) string {
+	if text == m.Text(url) {
+		return "<" + url + ">"
+	}
+	return "[" + text + "](" + url + ")"
+}
+
+type htmlmarkup struct{}
+
+func (htmlmarkup) Text(s string) string   { return html.EscapeString(s) }
+func (htmlmarkup) Emph(s string) string   { return "<em>" + s + "</em>" }
+func (htmlmarkup) Strong(s string) string { return "<strong>" + s + "</strong>" }
+func (htmlmarkup) Code(s string) string   { return "<code>" + s + "</code>" }
+
+func (htmlmarkup) Link(url, text string) string {
+	return `<a href="` + html.EscapeString(url) + `">` + text + "</a>"
+}
+
+// DecodeLaTeX converts LaTeX markup in s to Unicode text rendered with the
+// given markup. Handles accents, special characters, dashes, quotes, ties,
+// escaped characters and common text formatting commands. Braces are removed.
+func DecodeLaTeX(s string, m Markup) string {
+	d := &latexDecoder{src: s, m: m}
+	return strings.TrimSpace(d.sequence())
+}
+
+// latexDecoder is a recursive descent decoder for a subset of LaTeX.
+type latexDecoder struct {
+	src string
+	pos int
+	m   Markup
+}
+
+// sequence decodes until the end of input or an unmatched closing brace.
+func (d *latexDecoder) sequence() string {
+	var out, text strings.Builder
+	flush := func() {
+		out.WriteString(d.m.Text(text.String()))
+		text.Reset()
+	}
+
+	for d.pos < len(d.src) {
+		c := d.src[d.pos]
+		switch {
+		case c == '}':
+			flush()
+			return out.String()
+		case c == '{':
+			flush()
+			out.WriteString(d.group())
+		case c == '\\':
+			flush()
+			out.WriteString(d.command())
+		case c == '$':
+			d.pos++
+		case c == '~':
+			text.WriteByte(' ')
+			d.pos++
+		case c == '-':
+			n := d.run('-')
+			switch {
+			case n == 2:
+				text.WriteString("–")
+			case n >= 3:
+				text.WriteString("—")
+			default:
+				text.WriteString(strings.Repeat("-", n))
+			}
+		case c == '`':
+			if d.run('`') >= 2 {
+				text.WriteString("“")
+			} else {
+				text.WriteString("‘")
+			}
+		case strings.HasPrefix(d.src[d.pos:], "''"):
+			text.WriteString("”")
+			d.pos += 2
+		case isSpace(c):
+			d.skipSpace()
+			text.WriteByte(' ')
+		default:
+			r, size := utf8.DecodeRuneInString(d.src[d.pos:])
+			text.WriteRune(r)
+			d.pos += size
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// group decodes a braced group, returning its rendered content.
+func (d *latexDecoder) group() string {
+	d.pos++ // {
+	s := d.sequence()
+	if d.pos < len(d.src) {
+		d.pos++ // }
+	}
+	return s
+}
+
+// argument decodes a command argument, which is either a braced group or a
+// single character or command.
+func (d *latexDecoder) argument() string {
+	d.skipSpace()
+	if d.pos >= len(d.src) {
+		return ""
+	}
+	switch d.src[d.pos] {
+	case '{':
+		return d.group()
+	case '\\':
+		return d.command()
+	}
+	r, size := utf8.DecodeRuneInString(d.src[d.pos:])
+	d.pos += size
+	return d.m.Text(string(r))
+}
+
+// verbatim returns a raw braced argument without decoding.
+func (d *latexDecoder) verbatim() string {
+	d.skipSpace()
+	if d.pos >= len(d.src) || d.src[d.pos] != '{' {
+		return ""
+	}
+	depth := 0
+	for start := d.pos; d.pos < len(d.src); d.pos++ {
+		switch d.src[d.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				d.pos++
+				return d.src[start+1 : d.pos-1]
+			}
+		}
+	}
+	return ""
+}
+
+// command decodes a control sequence starting at a backslash.
+func (d *latexDecoder) command() string {
+	d.pos++ // \
+	if d.pos >= len(d.src) {
+		return d.m.Text(`\`)
+	}
+
+	// Control words are letters, and consume following whitespace. Control
+	// symbols are a single character.
+	name, space := "", ""
+	if isLetter(d.src[d.pos]) {
+		start := d.pos
+		for d.pos < len(d.src) && isLetter(d.src[d.pos]) {
+			d.pos++
+		}
+		name = d.src[start:d.pos]
+		if d.pos < len(d.src) && isSpace(d.src[d.pos]) {
+			space = " "
+		}
+		d.skipSpace()
+	} else {
+		r, size := utf8.DecodeRuneInString(d.src[d.pos:])
+		name = string(r)
+		d.pos += size
+	}
+
+	if combining, ok := accents[name]; ok {
+		return d.m.Text(accent(d.accentArgument(), combining))
+	}
+
+	if s, ok := latexSymbols[name]; ok {
+		return d.m.Text(s)
+	}
+
+	switch name {
+	case "emph", "textit", "textsl":
+		return d.m.Emph(d.argument())
+	case "textbf":
+		return d.m.Strong(d.argument())
+	case "texttt":
+		return d.m.Code(d.argument())
+	case "url":
+		u := d.verbatim()
+		return d.m.Link(u, d.m.Text(u))
+	case "href":
+		u := d.verbatim()
+		return d.m.Link(u, d.argument())
+	case "textrm", "textsf", "textsc", "textup", "textmd", "textnormal", "mbox", "text":
+		return d.argument()
+	case "em", "it", "bf", "sl", "sc", "tt", "rm", "sf", "relax", "protect":
+		return ""
+	}
+
+	// Preserve unknown commands, including the space that terminated them.
+	return d.m.Text(`\` + name + space)
+}
+
+// accentArgument returns the plain text of the argument to an accent command.
+func (d *latexDecoder) accentArgument() string {
+	m := d.m
+	d.m = PlainText
+	defer func() { d.m = m }()
+
+	arg := d.argument()
+	switch arg {
+	case "ı":
+		return "i"
+	case "ȷ":
+		return "j"
+	}
+	return arg
+}
+
+// run consumes a run of the character c, returning its length.
+func (d *latexDecoder) run(c byte) int {
+	n := 0
+	for d.pos < len(d.src) && d.src[d.pos] == c {
+		d.pos++
+		n++
+	}
+	return n
+}
+
+func (d *latexDecoder) skipSpace() {
+	for d.pos < len(d.src) && isSpace(d.src[d.pos]) {
+		d.pos++
+	}
+}
+
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+// accent applies the combining character to the first character of s, using
+// a precomposed character if one is known.
+func accent(s string, combining rune) string {
+	if s == "" {
+		return string(combining)
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	for _, pair := range splitPairs(precomposed[combining]) {
+		if pair[0] == r {
+			return string(pair[1]) + s[size:]
+		}
+	}
+	if !unicode.IsLetter(r) {
+		return s
+	}
+	return string(r) + string(combining) + s[size:]
+}
+
+// splitPairs splits a string into pairs of runes.
+func splitPairs(s string) [][2]rune {
+	runes := []rune(s)
+	pairs := make([][2]rune, 0, len(runes)/2)
+	for i := 0; i+1 < len(runes); i += 2 {
+		pairs = append(pairs, [2]rune{runes[i], runes[i+1]})
+	}
+	return pairs
+}
+
+// accents maps LaTeX accent commands to Unicode combining characters.
+var accents = map[string]rune{
+	`"`: '\u0308', // diaeresis
+	`'`: '\u0301', // acute
+	"`": '\u0300', // grave
+	`^`: '\u0302', // circumflex
+	`~`: '\u0303', // tilde
+	`=`: '\u0304', // macron
+	`.`: '\u0307', // dot above
+	`u`: '\u0306', // breve
+	`v`: '\u030c', // caron
+	`H`: '\u030b', // double acute
+	`c`: '\u0327', // cedilla
+	`k`: '\u0328', // ogonek
+	`r`: '\u030a', // ring above
+	`d`: '\u0323', // dot below
+}
+
+// precomposed lists pairs of base letter and precomposed character for each
+// combining character.
+var precomposed = map[rune]string{
+	'\u0308': "AÄaäEËeëHḦhḧIÏiïOÖoötẗUÜuüWẄwẅXẌxẍYŸyÿ",
+	'\u0301': "AÁaáCĆcćEÉeéGǴgǵIÍiíKḰkḱLĹlĺMḾmḿNŃnńOÓoóRŔrŕSŚsśUÚuúWẂwẃYÝyýZŹzź",
+	'\u0300': "AÀaàEÈeèIÌiìNǸnǹOÒoòUÙuùWẀwẁYỲyỳ",
+	'\u0302': "AÂaâCĈcĉEÊeêGĜgĝHĤhĥIÎiîJĴjĵOÔoôSŜsŝUÛuûWŴwŵYŶyŷZẐzẑ",
+	'\u0303': "AÃaãEẼeẽIĨiĩNÑnñOÕoõUŨuũYỸyỹ",
+	'\u0304': "AĀaāEĒeēGḠgḡIĪiīOŌoōUŪuūYȲyȳ",
+	'\u0307': "AȦaȧBḂbḃCĊcċDḊdḋEĖeėGĠgġHḢhḣIİMṀmṁNṄnṅOȮoȯRṘrṙSṠsṡTṪtṫWẆwẇXẊxẋYẎyẏZŻzż",
+	'\u0306': "AĂaăEĔeĕGĞgğIĬiĭOŎoŏUŬuŭ",
+	'\u030c': "AǍaǎCČcčDĎdďEĚeěGǦgǧHȞhȟIǏiǐjǰKǨkǩLĽlľNŇnňOǑoǒRŘrřSŠsšTŤtťUǓuǔZŽzž",
+	'\u030b': "OŐoőUŰuű",
+	'\u0327': "CÇcçDḐdḑEȨeȩGĢgģHḨhḩKĶkķLĻlļNŅnņRŖrŗSŞsşTŢtţ",
+	'\u0328': "AĄaąEĘeęIĮiįOǪoǫUŲuų",
+	'\u030a': "AÅaåUŮuůwẘyẙ",
+	'\u0323': "AẠaạBḄbḅDḌdḍEẸeẹHḤhḥIỊiịKḲkḳLḶlḷMṂmṃNṆnṇOỌoọRṚrṛSṢsṣTṬtṭUỤuụWẈwẉYỴyỵZẒzẓ",
+}
+
+// latexSymbols maps LaTeX commands to the text they produce.
+var latexSymbols = map[string]string{
+	// Escaped characters.
+	"&": "&",
+	"%": "%",
+	"$": "$",
+	"#": "#",
+	"_": "_",
+	"{": "{",
+	"}": "}",
+	`\`: " ",
+	" ": " ",
+	",": " ",
+	"-": "",
+	"/": "",
+	"@": "",
+
+	// Special letters.
+	"ss": "ß",
+	"o":  "ø",
+	"O":  "Ø",
+	"ae": "æ",
+	"AE": "Æ",
+	"oe": "œ",
+	"OE": "Œ",
+	"aa": "å",
+	"AA": "Å",
+	"l":  "ł",
+	"L":  "Ł",
+	"i":  "ı",
+	"j":  "ȷ",
+	"dh": "ð",
+	"DH": "Ð",
+	"th": "þ",
+	"TH": "Þ",
+
+	// Punctuation and symbols.
+	"ldots":             "…",
+	"dots":              "…",
+	"textellipsis":      "…",
+	"textendash":        "–",
+	"textemdash":        "—",
+	"textasciitilde":    "~",
+	"textasciicircum":   "^",
+	"textbackslash":     `\`,
+	"textbar":           "|",
+	"textless":          "<",
+	"textgreater":       ">",
+	"textquotedblleft":  "“",
+	"textquotedblright": "”",
+	"textquoteleft":     "‘",
+	"textquoteright":    "’",
+	"guillemotleft":     "«",
+	"guillemotright":    "»",
+	"textbullet":        "•",
+	"textdegree":        "°",
+	"S":                 "§",
+	"P":                 "¶",
+	"copyright":         "©",
+	"textcopyright":     "©",
+	"textregistered":    "®",
+	"texttrademark":     "™",
+	"euro":              "€",
+	"texteuro":          "€",
+	"pounds":            "£",
+	"textsterling":      "£",
+	"LaTeX":             "LaTeX",
+	"TeX":               "TeX",
+	"BibTeX":            "BibTeX",
+}
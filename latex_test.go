@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestDecodeLaTeX(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Expect string
+	}{
+		{`plain text`, `plain text`},
+		{`{Go} {\TeX}`, `Go TeX`},
+		{`Erd\H{o}s`, `Erdős`},
+		{`Schr\"{o}dinger`, `Schrödinger`},
+		{`Schr\"odinger`, `Schrödinger`},
+		{`G{\"o}del`, `Gödel`},
+		{`Fran\c{c}ois`, `François`},
+		{`\'{\i}`, `í`},
+		{`\aa{}ngstr\"om`, `ångström`},
+		{`Stra\ss e`, `Straße`},
+		{`pages 1--10`, `pages 1–10`},
+		{`Title---Subtitle`, `Title—Subtitle`},
+		{"``quoted''", `“quoted”`},
+		{`Prof.~Knuth`, `Prof. Knuth`},
+		{`$O(n)$`, `O(n)`},
+		{`100\%`, `100%`},
+		{"multiple\n  spaces", `multiple spaces`},
+		{`\unknown command`, `\unknown command`},
+	}
+	for _, c := range cases {
+		if got := DecodeLaTeX(c.Input, PlainText); got != c.Expect {
+			t.Errorf("DecodeLaTeX(%q) = %q; expect %q", c.Input, got, c.Expect)
+		}
+	}
+}
+
+func TestDecodeLaTeXMarkup(t *testing.T) {
+	input := `The \emph{Go} \textbf{R\&D} \texttt{go.mod} at \url{https://go.dev/a_b} <x>`
+	escapes := `Use \_ and *stars* [not a link] \texttt{a\_b*c}`
+	cases := []struct {
+		Name   string
+		Markup Markup
+		Input  string
+		Expect string
+	}{
+		{"plain", PlainText, input, `The Go R&D go.mod at https://go.dev/a_b <x>`},
+		{"markdown", Markdown, input, "The *Go* **R&D** `go.mod` at <https://go.dev/a_b> \\<x\\>"},
+		{"html", HTML, input, `The <em>Go</em> <strong>R&amp;D</strong> <code>go.mod</code> at <a href="https://go.dev/a_b">https://go.dev/a_b</a> &lt;x&gt;`},
+		{"markdown_escapes", Markdown, escapes, "Use \\_ and \\*stars\\* \\[not a link\\] `a_b*c`"},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			if got := DecodeLaTeX(c.Input, c.Markup); got != c.Expect {
+				t.Errorf("got    = %s", got)
+				t.Errorf("expect = %s", c.Expect)
+			}
+		})
+	}
+}
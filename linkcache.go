@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LinkRecord is the result of checking a link, as stored in a LinkCache.
+type LinkRecord struct {
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Checked  time.Time `json:"checked"`
+	FinalURL string    `json:"final_url,omitempty"`
+
+	// Redirects followed to reach the final URL.
+	Redirects []Redirect `json:"redirects,omitempty"`
+
+	// Validators for conditional requests.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// OK reports whether the link was found to exist.
+func (r LinkRecord) OK() bool {
+	return r.Error == "" && r.Status != 0
+}
+
+// LinkCache is an on-disk cache of link check results, keyed by URL. A nil
+// cache records nothing.
+type LinkCache struct {
+	Path string
+
+	mu    sync.Mutex
+	links map[string]LinkRecord
+}
+
+// NewLinkCache returns an empty cache to be saved at path.
+func NewLinkCache(path string) *LinkCache {
+	return &LinkCache{
+		Path:  path,
+		links: map[string]LinkRecord{},
+	}
+}
+
+// OpenLinkCache loads the cache at path. A missing file is an empty cache.
+func OpenLinkCache(path string) (*LinkCache, error) {
+	c := NewLinkCache(path)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &c.links); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// DefaultLinkCachePath returns the default location of the link cache in the
+// user cache directory, or the empty string if there is none.
+func DefaultLinkCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bib", "linkcheck.json")
+}
+
+// Get the record for a URL.
+func (c *LinkCache) Get(u string) (LinkRecord, bool) {
+	if c == nil {
+		return LinkRecord{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rec, ok := c.links[u]
+	return rec, ok
+}
+
+// Put the record for a URL.
+func (c *LinkCache) Put(u string, rec LinkRecord) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.links[u] = rec
+}
+
+// Save writes the cache to its file, creating the directory if necessary.
+func (c *LinkCache) Save() error {
+	c.mu.Lock()
+	b, err := json.MarshalIndent(c.links, "", "\t")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so that an interrupted run does
+	// not leave a corrupt cache. The temporary file is unique so that
+	// concurrent runs do not write to the same one.
+	tmp, err := ioutil.TempFile(dir, filepath.Base(c.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.Path)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLinkCacheSaveOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cache", "linkcheck.json")
+	c, err := OpenLinkCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := LinkRecord{
+		Status:   http.StatusOK,
+		Checked:  time.Date(2020, time.March, 5, 12, 0, 0, 0, time.UTC),
+		FinalURL: "https://example.com/final",
+		ETag:     `"abc"`,
+	}
+	c.Put("https://example.com", rec)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := OpenLinkCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := loaded.Get("https://example.com")
+	if !ok || !reflect.DeepEqual(got, rec) {
+		t.Fatalf("got %#v; expect %#v", got, rec)
+	}
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files in cache directory; expect 1", len(files))
+	}
+}
+
+func TestOpenLinkCacheCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "linkcheck.json")
+	if err := ioutil.WriteFile(path, []byte(`{"https://example.com": {"sta`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = OpenLinkCache(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Fatalf("got error %v; expect error naming %s", err, path)
+	}
+}
+
+func TestLinkCheckerCache(t *testing.T) {
+	const etag = `"v1"`
+	var requests, notmodified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notmodified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := testLinkChecker()
+	c.Cache = &LinkCache{links: map[string]LinkRecord{}}
+
+	// First check records the link.
+	result := c.check(ctx, srv.URL)
+	if result.Err != nil || result.Cached {
+		t.Fatalf("unexpected result %#v", result)
+	}
+	rec, ok := c.Cache.Get(srv.URL)
+	if !ok || rec.Status != http.StatusOK || rec.ETag != etag || rec.FinalURL != srv.URL {
+		t.Fatalf("unexpected record %#v", rec)
+	}
+
+	// Revalidation uses a conditional request.
+	result = c.check(ctx, srv.URL)
+	if result.Err != nil || result.Status != http.StatusOK || notmodified != 1 {
+		t.Fatalf("unexpected result %#v after %d not modified responses", result, notmodified)
+	}
+	if rec, _ := c.Cache.Get(srv.URL); rec.ETag != etag {
+		t.Fatalf("lost etag on revalidation: %#v", rec)
+	}
+
+	// Recently verified links are skipped.
+	c.MaxAge = time.Hour
+	before := requests
+	result = c.check(ctx, srv.URL)
+	if result.Err != nil || !result.Cached || requests != before {
+		t.Fatalf("unexpected result %#v with %d requests", result, requests-before)
+	}
+
+	// Unless the verification is too old.
+	rec, _ = c.Cache.Get(srv.URL)
+	rec.Checked = rec.Checked.Add(-2 * time.Hour)
+	c.Cache.Put(srv.URL, rec)
+	result = c.check(ctx, srv.URL)
+	if result.Cached || requests == before {
+		t.Fatalf("expected stale record to be revalidated")
+	}
+}
+
+func TestLinkCheckerCacheFailure(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	c := testLinkChecker()
+	c.Cache = &LinkCache{links: map[string]LinkRecord{}}
+	c.MaxAge = time.Hour
+
+	// Failures are recorded, but always checked again.
+	for i := 0; i < 2; i++ {
+		if err := c.CheckLink(context.Background(), srv.URL); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if requests != 4 {
+		t.Fatalf("got %d requests; expect 4", requests)
+	}
+	rec, _ := c.Cache.Get(srv.URL)
+	if rec.OK() || rec.Status != http.StatusNotFound || rec.Error != "http status 404" {
+		t.Fatalf("unexpected record %#v", rec)
+	}
+}
@@ -2,33 +2,444 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Links gathers all the URLs from a bibliography.
+// Links gathers all the URLs from a bibliography, including links to
+// identifiers such as DOIs.
 func Links(b *Bibliography) []string {
 	var links []string
+	seen := map[string]bool{}
 	for _, entry := range b.Entries {
-		link, ok := entry.Fields["url"]
-		if !ok {
-			continue
+		candidates := []string{entry.Field("url")}
+		for _, id := range entry.Identifiers() {
+			candidates = append(candidates, id.URL())
+		}
+		for _, link := range candidates {
+			if link != "" && !seen[link] {
+				links = append(links, link)
+				seen[link] = true
+			}
 		}
-		links = append(links, link.String())
 	}
 	return links
 }
 
+// DefaultArchive is the base URL of the Internet Archive, which may be used
+// to find snapshots of links that no longer work.
+const DefaultArchive = "https://web.archive.org/web/"
+
+// Fallbacks gathers the alternative locations of the url of each entry in the
+// bibliography, keyed by url. These are the mirror and archiveurl fields, and
+// the snapshot of the url in the web archive at the given base URL, if it is
+// not empty.
+func Fallbacks(b *Bibliography, archive string) map[string][]string {
+	fallbacks := map[string][]string{}
+	for _, entry := range b.Entries {
+		link := entry.Field("url")
+		if link == "" {
+			continue
+		}
+		candidates := []string{entry.Field("mirror"), entry.Field("archiveurl")}
+		if archive != "" {
+			candidates = append(candidates, archive+link)
+		}
+		for _, candidate := range candidates {
+			if candidate != "" && !contains(fallbacks[link], candidate) {
+				fallbacks[link] = append(fallbacks[link], candidate)
+			}
+		}
+	}
+	return fallbacks
+}
+
+// contains reports whether the list contains s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkChecker checks whether URLs exist. Links are checked concurrently,
+// subject to limits on the requests made to each host.
+type LinkChecker struct {
+	// Client for HTTP requests. Uses http.DefaultClient if nil.
+	Client *http.Client
+
+	// Workers is the number of links checked concurrently.
+	Workers int
+
+	// PerHost limits the number of concurrent requests to a host, and Delay
+	// is the minimum time between the start of requests to it. Zero values
+	// mean no limit.
+	PerHost int
+	Delay   time.Duration
+
+	// Timeout for each request. Zero means no timeout.
+	Timeout time.Duration
+
+	// Retries is the number of times a request is retried after a 429 or 5xx
+	// response. The wait before each retry starts at Backoff and doubles,
+	// unless the server gives a Retry-After header. Waits are limited to
+	// MaxBackoff.
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Cache of results from previous runs, if not nil. Links that were
+	// verified within MaxAge are not checked again.
+	Cache  *LinkCache
+	MaxAge time.Duration
+
+	// Fragments enables checking that the fragments of links exist in
+	// their content. See CheckFragment.
+	Fragments bool
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+// NewLinkChecker returns a link checker with default settings.
+func NewLinkChecker() *LinkChecker {
+	return &LinkChecker{
+		Workers:    8,
+		PerHost:    2,
+		Delay:      100 * time.Millisecond,
+		Timeout:    30 * time.Second,
+		Retries:    3,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+	}
+}
+
+// LinkResult is the outcome of checking a link.
+type LinkResult struct {
+	URL string
+	Err error
+
+	// Status of the last response, and the final URL after redirects.
+	Status   int
+	FinalURL string
+
+	// Redirects followed to reach the final URL.
+	Redirects []Redirect
+
+	// Cached reports whether the result was taken from the cache without a
+	// request.
+	Cached bool
+}
+
+// Check the links concurrently. Results are returned in the order of the
+// given links.
+func (c *LinkChecker) Check(ctx context.Context, links []string) []LinkResult {
+	results := make([]LinkResult, len(links))
+	c.parallel(len(links), func(i int) {
+		results[i] = c.check(ctx, links[i])
+	})
+	return results
+}
+
+// parallel calls fn for each index up to n, in up to Workers goroutines.
+func (c *LinkChecker) parallel(n int, fn func(i int)) {
+	jobs := make(chan int)
+
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Fetch makes a GET request for the URL, with the same limits and retries as
+// link checks, and passes a successful response to read before its body is
+// closed.
+func (c *LinkChecker) Fetch(ctx context.Context, u string, read func(*http.Response) error) error {
+	_, err := c.request(ctx, http.MethodGet, u, LinkRecord{}, read)
+	return err
+}
+
 // CheckLink checks whether the given URL exists.
-func CheckLink(ctx context.Context, u string) (err error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+func (c *LinkChecker) CheckLink(ctx context.Context, u string) error {
+	return c.check(ctx, u).Err
+}
+
+// check a link. A HEAD request is tried first, falling back to GET for
+// servers that do not handle HEAD properly. Links verified within MaxAge are
+// not requested again, and others are revalidated with conditional requests.
+func (c *LinkChecker) check(ctx context.Context, u string) LinkResult {
+	rec, cached := c.Cache.Get(u)
+	if cached && rec.OK() && c.MaxAge > 0 && time.Since(rec.Checked) < c.MaxAge {
+		return LinkResult{URL: u, Status: rec.Status, FinalURL: rec.FinalURL, Redirects: rec.Redirects, Cached: true}
+	}
+	if !cached || !rec.OK() {
+		rec = LinkRecord{}
+	}
+
+	resp, err := c.request(ctx, http.MethodHead, u, rec, nil)
+	var status StatusError
+	if errors.As(err, &status) && !retryable(int(status)) {
+		resp, err = c.request(ctx, http.MethodGet, u, rec, nil)
+	}
+
+	if err == nil && c.Fragments {
+		err = c.CheckFragment(ctx, u)
+	}
+
+	// A resource that has not been modified keeps its recorded details.
+	if err == nil && resp.Status == http.StatusNotModified && rec.OK() {
+		resp.Status, resp.FinalURL, resp.Redirects = rec.Status, rec.FinalURL, rec.Redirects
+		resp.ETag, resp.LastModified = rec.ETag, rec.LastModified
+	}
+
+	result := LinkResult{URL: u, Err: err, Status: resp.Status, FinalURL: resp.FinalURL, Redirects: resp.Redirects}
+	if errors.Is(err, context.Canceled) {
+		return result
+	}
+
+	rec = LinkRecord{
+		Status:       resp.Status,
+		Checked:      time.Now(),
+		FinalURL:     resp.FinalURL,
+		Redirects:    resp.Redirects,
+		ETag:         resp.ETag,
+		LastModified: resp.LastModified,
+	}
 	if err != nil {
-		return err
+		rec.Error = err.Error()
 	}
+	c.Cache.Put(u, rec)
 
-	r, err := http.DefaultClient.Do(req)
+	return result
+}
+
+// Permanent returns the destination of the permanent redirects at the start
+// of the redirect chain, or the empty string if there are none.
+func (r LinkResult) Permanent() string {
+	dest := ""
+	for _, redirect := range r.Redirects {
+		if !redirect.Permanent() {
+			break
+		}
+		dest = redirect.URL
+	}
+	return dest
+}
+
+// Destinations returns replacements for links that work: the destination of
+// their permanent redirects, or the https form of http links where that also
+// works.
+func (c *LinkChecker) Destinations(ctx context.Context, results []LinkResult) map[string]string {
+	dests := map[string]string{}
+	upgrades := []string{}
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		dest := result.URL
+		if permanent := result.Permanent(); permanent != "" {
+			dest = permanent
+		}
+		dests[result.URL] = dest
+		if strings.HasPrefix(dest, "http://") {
+			upgrades = append(upgrades, "https://"+strings.TrimPrefix(dest, "http://"))
+		}
+	}
+
+	secure := map[string]string{}
+	for _, result := range c.Check(ctx, upgrades) {
+		if result.Err != nil {
+			continue
+		}
+		dest := result.URL
+		if permanent := result.Permanent(); permanent != "" {
+			dest = permanent
+		}
+		secure["http://"+strings.TrimPrefix(result.URL, "https://")] = dest
+	}
+
+	replace := map[string]string{}
+	for link, dest := range dests {
+		if upgrade, ok := secure[dest]; ok {
+			dest = upgrade
+		}
+		if dest != link {
+			replace[link] = dest
+		}
+	}
+	return replace
+}
+
+// URLFix is a change to a url field made by RewriteURLs.
+type URLFix struct {
+	Line int
+	Old  string
+	New  string
+}
+
+// RewriteURLs replaces the values of url fields in the file with their
+// replacements. Only fields with a literal value are changed.
+func RewriteURLs(f *BibFile, replace map[string]string) []URLFix {
+	var fixes []URLFix
+	for _, block := range f.Blocks {
+		if block.Kind != EntryBlock {
+			continue
+		}
+		for i, field := range block.Fields {
+			if field.Name != "url" || len(field.Value) != 1 || field.Value[0].Kind == MacroPart {
+				continue
+			}
+			part := field.Value[0]
+			dest, ok := replace[part.Text]
+			if !ok {
+				continue
+			}
+			block.Fields[i].Value = Value{{Kind: part.Kind, Text: dest}}
+			fixes = append(fixes, URLFix{Line: field.Line, Old: part.Text, New: dest})
+		}
+	}
+	return fixes
+}
+
+// Redirect is a step in a redirect chain.
+type Redirect struct {
+	// Status of the redirect response, and the URL redirected to.
+	Status int    `json:"status"`
+	URL    string `json:"url"`
+}
+
+// Permanent reports whether the redirect is a permanent move.
+func (r Redirect) Permanent() bool {
+	return r.Status == http.StatusMovedPermanently || r.Status == http.StatusPermanentRedirect
+}
+
+func (r Redirect) String() string {
+	return fmt.Sprintf("%d %s", r.Status, r.URL)
+}
+
+// StatusError reports an unsuccessful HTTP response status.
+type StatusError int
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("http status %d", int(e))
+}
+
+// linkResponse is the relevant information from a response.
+type linkResponse struct {
+	Status       int
+	RetryAfter   time.Duration
+	FinalURL     string
+	Redirects    []Redirect
+	ETag         string
+	LastModified string
+}
+
+// request makes a request, retrying on 429 and 5xx responses. The request is
+// conditional on the validators of the given record, if any. If read is not
+// nil, it is called with a successful response.
+func (c *LinkChecker) request(ctx context.Context, method, u string, rec LinkRecord, read func(*http.Response) error) (linkResponse, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, method, u, rec, read)
+		if err != nil {
+			return resp, err
+		}
+
+		if (resp.Status >= 200 && resp.Status < 300) || resp.Status == http.StatusNotModified {
+			return resp, nil
+		}
+
+		err = StatusError(resp.Status)
+		if !retryable(resp.Status) || attempt >= c.Retries {
+			return resp, err
+		}
+
+		wait := c.Backoff << uint(attempt)
+		if resp.RetryAfter > 0 {
+			wait = resp.RetryAfter
+		}
+		if c.MaxBackoff > 0 && wait > c.MaxBackoff {
+			if resp.RetryAfter > 0 {
+				return resp, fmt.Errorf("%w (retry after %s)", err, resp.RetryAfter)
+			}
+			wait = c.MaxBackoff
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return resp, err
+		}
+	}
+}
+
+// do makes a single request, subject to the limits for the host.
+func (c *LinkChecker) do(ctx context.Context, method, u string, rec LinkRecord, read func(*http.Response) error) (resp linkResponse, err error) {
+	req, err := http.NewRequest(method, u, nil)
 	if err != nil {
-		return err
+		return resp, err
+	}
+	if rec.ETag != "" {
+		req.Header.Set("If-None-Match", rec.ETag)
+	}
+	if rec.LastModified != "" {
+		req.Header.Set("If-Modified-Since", rec.LastModified)
+	}
+
+	host := c.host(req.URL.Host)
+	if err := host.acquire(ctx); err != nil {
+		return resp, err
+	}
+	defer host.release()
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// Record redirects as they are followed.
+	recorder := *client
+	recorder.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		resp.Redirects = append(resp.Redirects, Redirect{Status: req.Response.StatusCode, URL: req.URL.String()})
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	r, err := recorder.Do(req.WithContext(ctx))
+	if err != nil {
+		return resp, err
 	}
 	defer func() {
 		if errc := r.Body.Close(); errc != nil && err == nil {
@@ -36,9 +447,117 @@ func CheckLink(ctx context.Context, u string) (err error) {
 		}
 	}()
 
-	if r.StatusCode != http.StatusOK {
-		return fmt.Errorf("http status %d", r.StatusCode)
+	resp.Status = r.StatusCode
+	resp.RetryAfter = parseRetryAfter(r.Header.Get("Retry-After"), time.Now())
+	resp.FinalURL = r.Request.URL.String()
+	resp.ETag = r.Header.Get("ETag")
+	resp.LastModified = r.Header.Get("Last-Modified")
+
+	if read != nil && r.StatusCode >= 200 && r.StatusCode < 300 {
+		return resp, read(r)
+	}
+
+	return resp, nil
+}
+
+// host returns the limiter for the named host.
+func (c *LinkChecker) host(name string) *hostLimiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hosts == nil {
+		c.hosts = map[string]*hostLimiter{}
+	}
+	h, ok := c.hosts[name]
+	if !ok {
+		h = &hostLimiter{delay: c.Delay}
+		if c.PerHost > 0 {
+			h.sem = make(chan struct{}, c.PerHost)
+		}
+		c.hosts[name] = h
+	}
+	return h
+}
+
+// hostLimiter limits concurrency and rate of requests to a host.
+type hostLimiter struct {
+	sem   chan struct{}
+	delay time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// acquire waits until a request to the host may start.
+func (h *hostLimiter) acquire(ctx context.Context) error {
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
+	now := time.Now()
+	if err := sleep(ctx, h.reserve(now).Sub(now)); err != nil {
+		h.release()
+		return err
+	}
 	return nil
 }
+
+// reserve returns the time the next request to the host may start, at least
+// the delay after the previously reserved start.
+func (h *hostLimiter) reserve(now time.Time) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	start := h.next
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(h.delay)
+	return start
+}
+
+// release marks the end of a request to the host.
+func (h *hostLimiter) release() {
+	if h.sem != nil {
+		<-h.sem
+	}
+}
+
+// retryable reports whether a request with the given response status should
+// be retried.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// parseRetryAfter parses a Retry-After header value, given either in seconds
+// or as an HTTP date. Returns zero if the value is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// sleep waits for the duration d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
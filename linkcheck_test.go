@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLinkChecker returns a link checker with short delays for testing.
+func testLinkChecker() *LinkChecker {
+	return &LinkChecker{
+		Workers:    4,
+		Timeout:    5 * time.Second,
+		Retries:    2,
+		Backoff:    time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+}
+
+func TestLinkCheckerStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/notfound", http.NotFound)
+	mux.HandleFunc("/gethonly", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cases := map[string]string{
+		"/ok":          "",
+		"/notfound":    "http status 404",
+		"/gethonly":    "",
+		"/unavailable": "http status 503",
+	}
+	for path, expect := range cases {
+		err := testLinkChecker().CheckLink(context.Background(), srv.URL+path)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != expect {
+			t.Errorf("%s: got error %q; expect %q", path, got, expect)
+		}
+	}
+}
+
+func TestLinkCheckerRetry(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	if err := testLinkChecker().CheckLink(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("got %d requests; expect 3", requests)
+	}
+}
+
+func TestLinkCheckerRetryLimit(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := testLinkChecker()
+	if err := c.CheckLink(context.Background(), srv.URL); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Retryable failures of HEAD do not fall back to GET.
+	if expect := int32(c.Retries + 1); requests != expect {
+		t.Fatalf("got %d requests; expect %d", requests, expect)
+	}
+}
+
+func TestLinkCheckerRetryAfter(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	if err := testLinkChecker().CheckLink(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %s; expect at least 1s", elapsed)
+	}
+
+	// Give up if the server asks for too long a wait.
+	requests = 0
+	c := testLinkChecker()
+	c.MaxBackoff = 500 * time.Millisecond
+	err := c.CheckLink(context.Background(), srv.URL)
+	if err == nil || err.Error() != "http status 429 (retry after 1s)" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestLinkCheckerTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c := testLinkChecker()
+	c.Timeout = 50 * time.Millisecond
+	if err := c.CheckLink(context.Background(), srv.URL); err == nil {
+		t.Fatal("expected timeout")
+	}
+}
+
+func TestLinkCheckerPerHost(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	var links []string
+	for i := 0; i < 10; i++ {
+		links = append(links, srv.URL+"/"+strconv.Itoa(i))
+	}
+
+	c := testLinkChecker()
+	c.Workers = 8
+	c.PerHost = 2
+	c.Delay = 5 * time.Millisecond
+	results := c.Check(context.Background(), links)
+
+	for i, result := range results {
+		if result.URL != links[i] {
+			t.Errorf("result %d for %s; expect %s", i, result.URL, links[i])
+		}
+		if result.Err != nil {
+			t.Error(result.Err)
+		}
+	}
+	if peak > c.PerHost {
+		t.Errorf("peak of %d concurrent requests exceeds limit %d", peak, c.PerHost)
+	}
+}
+
+func TestHostLimiterReserve(t *testing.T) {
+	h := &hostLimiter{delay: 5 * time.Millisecond}
+	now := time.Date(2020, time.March, 5, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		Now    time.Duration
+		Expect time.Duration
+	}{
+		{0, 0},
+		{0, 5 * time.Millisecond},
+		{1 * time.Millisecond, 10 * time.Millisecond},
+		{30 * time.Millisecond, 30 * time.Millisecond},
+		{31 * time.Millisecond, 35 * time.Millisecond},
+	}
+	for i, c := range cases {
+		if got := h.reserve(now.Add(c.Now)).Sub(now); got != c.Expect {
+			t.Errorf("reservation %d at %s starts at %s; expect %s", i, c.Now, got, c.Expect)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.March, 5, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Thu, 05 Mar 2020 12:00:30 GMT": 30 * time.Second,
+		"Thu, 05 Mar 2020 11:00:00 GMT": 0,
+	}
+	for value, expect := range cases {
+		if got := parseRetryAfter(value, now); got != expect {
+			t.Errorf("parseRetryAfter(%q) = %s; expect %s", value, got, expect)
+		}
+	}
+}
+
+func TestLinkCheckerRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.Handle("/new", http.RedirectHandler("/final", http.StatusFound))
+	mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	result := testLinkChecker().check(context.Background(), srv.URL+"/old")
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	expect := []Redirect{
+		{Status: http.StatusMovedPermanently, URL: srv.URL + "/new"},
+		{Status: http.StatusFound, URL: srv.URL + "/final"},
+	}
+	if !reflect.DeepEqual(result.Redirects, expect) {
+		t.Fatalf("got redirects %v; expect %v", result.Redirects, expect)
+	}
+	if result.FinalURL != srv.URL+"/final" {
+		t.Errorf("got final url %q", result.FinalURL)
+	}
+	if result.Permanent() != srv.URL+"/new" {
+		t.Errorf("got permanent destination %q", result.Permanent())
+	}
+}
+
+// roundTripFunc is an http.RoundTripper implemented by a function.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestLinkCheckerDestinations(t *testing.T) {
+	// Responses by URL. Unknown URLs fail to connect.
+	redirects := map[string]string{
+		"http://a.example/moved": "https://b.example/page",
+		"http://f.example/moved": "http://g.example/new",
+		"https://e.example/temp": "https://e.example/other",
+	}
+	ok := map[string]bool{
+		"https://b.example/page":  true,
+		"http://c.example/page":   true,
+		"https://c.example/page":  true,
+		"http://d.example/page":   true,
+		"https://e.example/other": true,
+		"http://g.example/new":    true,
+		"https://g.example/new":   true,
+	}
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		u := req.URL.String()
+		resp := &http.Response{Header: http.Header{}, Body: http.NoBody, Request: req}
+		switch {
+		case redirects[u] != "":
+			resp.StatusCode = http.StatusMovedPermanently
+			if strings.Contains(u, "temp") {
+				resp.StatusCode = http.StatusFound
+			}
+			resp.Header.Set("Location", redirects[u])
+		case ok[u]:
+			resp.StatusCode = http.StatusOK
+		default:
+			return nil, errors.New("connection refused")
+		}
+		return resp, nil
+	})
+
+	c := testLinkChecker()
+	c.Client = &http.Client{Transport: transport}
+
+	ctx := context.Background()
+	results := c.Check(ctx, []string{
+		"http://a.example/moved",
+		"http://c.example/page",
+		"http://d.example/page",
+		"https://e.example/temp",
+		"http://f.example/moved",
+		"http://missing.example/",
+	})
+
+	got := c.Destinations(ctx, results)
+	expect := map[string]string{
+		"http://a.example/moved": "https://b.example/page",
+		"http://c.example/page":  "https://c.example/page",
+		"http://f.example/moved": "https://g.example/new",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v; expect %v", got, expect)
+	}
+}
+
+func TestRewriteURLs(t *testing.T) {
+	src := `@string{home = "http://example.com/"}
+
+@misc{a,
+    title = "A",
+    url   = "http://example.com/a",
+}
+
+@misc{b,
+    title = "B",
+    url   = {http://example.com/b},
+}
+
+@misc{c,
+    title = "C",
+    url   = home,
+}
+`
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixes := RewriteURLs(f, map[string]string{
+		"http://example.com/a": "https://example.com/a",
+		"http://example.com/b": "https://example.org/b",
+		"http://example.com/":  "https://example.com/",
+	})
+
+	expect := []URLFix{
+		{Line: 5, Old: "http://example.com/a", New: "https://example.com/a"},
+		{Line: 10, Old: "http://example.com/b", New: "https://example.org/b"},
+	}
+	if !reflect.DeepEqual(fixes, expect) {
+		t.Fatalf("got fixes %v; expect %v", fixes, expect)
+	}
+
+	got := string(FormatBibTeX(f, DefaultFormatOptions))
+	for _, want := range []string{`url   = "https://example.com/a",`, `url   = "https://example.org/b",`, `url   = home,`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatted output missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	f, err := ParseBibFile("test.bib", []byte(`
+@misc{mirrored,
+    title      = "Mirrored",
+    url        = "https://example.com/guide.pdf",
+    mirror     = "https://mirror.example.org/guide.pdf",
+    archiveurl = "https://archive.example.org/2020/https://example.com/guide.pdf",
+}
+
+@misc{plain,
+    title = "Plain",
+    url   = "https://example.com/plain",
+}
+
+@misc{nourl,
+    title  = "No URL",
+    mirror = "https://mirror.example.org/nourl",
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Bibliography()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Fallbacks(b, "https://archive.example.org/")
+	expect := map[string][]string{
+		"https://example.com/guide.pdf": {
+			"https://mirror.example.org/guide.pdf",
+			"https://archive.example.org/2020/https://example.com/guide.pdf",
+			"https://archive.example.org/https://example.com/guide.pdf",
+		},
+		"https://example.com/plain": {
+			"https://archive.example.org/https://example.com/plain",
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v; expect %v", got, expect)
+	}
+
+	// Without an archive, only the fields are used.
+	got = Fallbacks(b, "")
+	expect = map[string][]string{
+		"https://example.com/guide.pdf": expect["https://example.com/guide.pdf"][:2],
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v; expect %v", got, expect)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// commonFields may appear in an entry of any type.
+var commonFields = []string{
+	"abstract", "annote", "archiveprefix", "archiveurl", "crossref", "date",
+	"doi", "eprint", "eprintclass", "eprinttype", "etag", "isbn", "issn", "key",
+	"keywords", "language", "mirror", "month", "note", "primaryclass", "sha256",
+	"size", "url", "urldate", "year",
+}
+
+// LintConfig configures the checks made by Lint.
+type LintConfig struct {
+	// Disabled rules.
+	Disabled map[string]bool
+
+	// Allowed fields in addition to those known for each entry type.
+	Allowed []string
+
+	// Required fields for entry types, in addition to those of the entry
+	// type specification.
+	Required map[string][]string
+}
+
+// ReadLintConfig reads a lint configuration file.
+func ReadLintConfig(path string) (*LintConfig, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLintConfig(path, src)
+}
+
+// ParseLintConfig parses a lint configuration. Each line is a directive:
+//
+//	disable <rule> ...
+//	allow <field> ...
+//	require <type> <field> ...
+//
+// Blank lines and lines starting with "#" are ignored. The filename is only
+// used for position information.
+func ParseLintConfig(filename string, src []byte) (*LintConfig, error) {
+	c := &LintConfig{
+		Disabled: map[string]bool{},
+		Required: map[string][]string{},
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for n := 1; scanner.Scan(); n++ {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+
+		directive, args := args[0], args[1:]
+		switch {
+		case directive == "disable" && len(args) > 0:
+			for _, rule := range args {
+				if _, ok := lintRules[rule]; !ok {
+					return nil, fmt.Errorf("%s:%d: unknown rule %q", filename, n, rule)
+				}
+				c.Disabled[rule] = true
+			}
+		case directive == "allow" && len(args) > 0:
+			for _, name := range args {
+				c.Allowed = append(c.Allowed, strings.ToLower(name))
+			}
+		case directive == "require" && len(args) > 1:
+			typ := strings.ToLower(args[0])
+			for _, name := range args[1:] {
+				c.Required[typ] = append(c.Required[typ], strings.ToLower(name))
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid directive %q", filename, n, scanner.Text())
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// LintError is a problem found in a bibliography file by Lint.
+type LintError struct {
+	Filename string
+	Line     int
+	Rule     string
+	Message  string
+}
+
+func (e LintError) Error() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", e.Filename, e.Line, e.Message, e.Rule)
+}
+
+// lintRule checks an entry, reporting problems to the linter.
+type lintRule func(l *linter, block *Block)
+
+// lintRules is the registry of lint rules.
+var lintRules = map[string]lintRule{
+	"type":            lintType,
+	"required":        lintRequired,
+	"unknown-field":   lintUnknownField,
+	"duplicate-field": lintDuplicateField,
+	"duplicate-key":   lintDuplicateKey,
+	"macro":           lintMacro,
+	"year":            lintYear,
+	"date":            lintDate,
+	"urldate":         lintURLDate,
+	"url":             lintURL,
+	"fingerprint":     lintFingerprint,
+}
+
+// LintRuleNames returns the names of lint rules.
+func LintRuleNames() []string {
+	names := []string{}
+	for name := range lintRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lint checks every entry in the file against the rules that are not
+// disabled by the configuration. Returns an ErrorList of LintErrors in file
+// order, or nil if there are no problems.
+func Lint(f *BibFile, c *LintConfig) error {
+	if c == nil {
+		c = &LintConfig{}
+	}
+
+	l := &linter{
+		file:    f,
+		config:  c,
+		macros:  map[string]string{},
+		entries: map[string]*Block{},
+	}
+	for name, value := range monthMacros {
+		l.macros[name] = value
+	}
+
+	rules := []string{}
+	for _, name := range LintRuleNames() {
+		if !c.Disabled[name] {
+			rules = append(rules, name)
+		}
+	}
+
+	for _, block := range f.Blocks {
+		if block.Kind == EntryBlock {
+			if _, exists := l.entries[block.Key]; !exists {
+				l.entries[block.Key] = block
+			}
+		}
+	}
+
+	for _, block := range f.Blocks {
+		switch block.Kind {
+		case StringBlock:
+			def := block.Fields[0]
+			if value, err := def.Value.Resolve(l.macros); err == nil {
+				l.macros[strings.ToLower(def.Name)] = value
+			} else if !c.Disabled["macro"] {
+				l.errorf(def.Line, "macro", "%s", err)
+			}
+
+		case EntryBlock:
+			for _, name := range rules {
+				lintRules[name](l, block)
+			}
+		}
+	}
+
+	if len(l.errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(l.errs, func(i, j int) bool {
+		return l.errs[i].(LintError).Line < l.errs[j].(LintError).Line
+	})
+	return l.errs
+}
+
+// linter holds the state of a Lint run.
+type linter struct {
+	file    *BibFile
+	config  *LintConfig
+	macros  map[string]string
+	entries map[string]*Block
+	errs    ErrorList
+}
+
+func (l *linter) errorf(line int, rule, format string, args ...interface{}) {
+	l.errs = append(l.errs, LintError{
+		Filename: l.file.Filename,
+		Line:     line,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// value returns the first definition of the named field, with macros
+// expanded. Reports false if the field is not defined or its value cannot be
+// resolved.
+func (l *linter) value(block *Block, name string) (Field, string, bool) {
+	for _, field := range block.Fields {
+		if field.Name == name {
+			value, err := field.Value.Resolve(l.macros)
+			return field, value, err == nil
+		}
+	}
+	return Field{}, "", false
+}
+
+// has reports whether the entry defines the named field, either directly or
+// by inheritance from its crossref entry.
+func (l *linter) has(block *Block, name string) bool {
+	for _, field := range block.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	if _, ref, ok := l.value(block, "crossref"); ok {
+		if parent := l.entries[ref]; parent != nil && parent != block {
+			if name == "booktitle" {
+				name = "title"
+			}
+			for _, field := range parent.Fields {
+				if field.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func lintType(l *linter, block *Block) {
+	if _, ok := entryTypes[strings.ToLower(block.Type)]; !ok {
+		l.errorf(block.Line, "type", "unknown entry type %q", block.Type)
+	}
+}
+
+func lintRequired(l *linter, block *Block) {
+	typ := strings.ToLower(block.Type)
+	required := append(append([]string{}, entryTypes[typ].Required...), l.config.Required[typ]...)
+
+	for _, item := range required {
+		satisfied := false
+		for _, name := range strings.Split(item, "|") {
+			satisfied = satisfied || l.has(block, name)
+		}
+		if !satisfied {
+			l.errorf(block.Line, "required", "%s %q: missing required field %q", typ, block.Key, strings.Replace(item, "|", `" or "`, -1))
+		}
+	}
+}
+
+func lintUnknownField(l *linter, block *Block) {
+	spec, ok := entryTypes[strings.ToLower(block.Type)]
+	if !ok {
+		return
+	}
+
+	known := map[string]bool{}
+	for _, names := range [][]string{spec.Required, spec.Optional, commonFields, l.config.Allowed, l.config.Required[strings.ToLower(block.Type)]} {
+		for _, item := range names {
+			for _, name := range strings.Split(item, "|") {
+				known[name] = true
+			}
+		}
+	}
+
+	for _, field := range block.Fields {
+		if !known[field.Name] {
+			l.errorf(field.Line, "unknown-field", "unknown field %q for %s entry", field.Name, strings.ToLower(block.Type))
+		}
+	}
+}
+
+func lintDuplicateField(l *linter, block *Block) {
+	seen := map[string]int{}
+	for _, field := range block.Fields {
+		if line, ok := seen[field.Name]; ok {
+			l.errorf(field.Line, "duplicate-field", "duplicate field %q (previously defined at line %d)", field.Name, line)
+			continue
+		}
+		seen[field.Name] = field.Line
+	}
+}
+
+func lintDuplicateKey(l *linter, block *Block) {
+	if first := l.entries[block.Key]; first != block {
+		l.errorf(block.Line, "duplicate-key", "duplicate key %q (previously defined at line %d)", block.Key, first.Line)
+	}
+}
+
+func lintMacro(l *linter, block *Block) {
+	for _, field := range block.Fields {
+		if _, err := field.Value.Resolve(l.macros); err != nil {
+			l.errorf(field.Line, "macro", "%s", err)
+		}
+	}
+}
+
+func lintYear(l *linter, block *Block) {
+	if field, year, ok := l.value(block, "year"); ok {
+		if _, err := strconv.Atoi(strings.TrimSpace(year)); err != nil {
+			l.errorf(field.Line, "year", "year %q is not a number", year)
+		}
+	}
+}
+
+func lintDate(l *linter, block *Block) {
+	if field, date, ok := l.value(block, "date"); ok {
+		if _, err := ParseDateRange(date); err != nil {
+			l.errorf(field.Line, "date", "%s", err)
+		}
+	}
+}
+
+func lintURLDate(l *linter, block *Block) {
+	if field, date, ok := l.value(block, "urldate"); ok {
+		if _, err := ParseDate(date); err != nil {
+			l.errorf(field.Line, "urldate", "urldate %q is not an ISO 8601 date", date)
+		}
+	}
+}
+
+func lintURL(l *linter, block *Block) {
+	for _, name := range []string{"url", "mirror", "archiveurl"} {
+		field, link, ok := l.value(block, name)
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(strings.TrimSpace(link))
+		switch {
+		case err != nil:
+			l.errorf(field.Line, "url", "invalid %s: %s", name, err)
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "ftp":
+			l.errorf(field.Line, "url", "%s %q must be absolute with http, https or ftp scheme", name, link)
+		case u.Host == "":
+			l.errorf(field.Line, "url", "%s %q has no host", name, link)
+		}
+	}
+}
+
+func lintFingerprint(l *linter, block *Block) {
+	if field, sum, ok := l.value(block, "sha256"); ok {
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != 2*sha256.Size {
+			l.errorf(field.Line, "fingerprint", "sha256 %q is not a hex SHA-256 digest", sum)
+		}
+	}
+	if field, size, ok := l.value(block, "size"); ok {
+		if n, err := strconv.ParseInt(size, 10, 64); err != nil || n < 0 {
+			l.errorf(field.Line, "fingerprint", "size %q is not a number of bytes", size)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	src := `@string{conf = "Proc. Conference"}
+
+@article{article,
+    title   = "Title",
+    author  = "Gopher, Go",
+    year    = "20x0",
+    title   = "Again",
+    urldate = "12/03/2020",
+    url     = "example.com/paper",
+}
+
+@inproceedings{paper,
+    title     = "Paper",
+    author    = "Gopher, Go",
+    crossref  = "proc",
+    booktitle = conf # " " # undefined,
+}
+
+@proceedings{proc,
+    title  = "Proceedings",
+    year   = 2020,
+    color  = "blue",
+    sha256 = "abc",
+    size   = "large",
+}
+
+@unknown{proc, title = "Unknown"}
+`
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		`test.bib:3: article "article": missing required field "journal" (required)`,
+		`test.bib:6: year "20x0" is not a number (year)`,
+		`test.bib:7: duplicate field "title" (previously defined at line 4) (duplicate-field)`,
+		`test.bib:8: urldate "12/03/2020" is not an ISO 8601 date (urldate)`,
+		`test.bib:9: url "example.com/paper" must be absolute with http, https or ftp scheme (url)`,
+		`test.bib:16: undefined macro "undefined" (macro)`,
+		`test.bib:22: unknown field "color" for proceedings entry (unknown-field)`,
+		`test.bib:23: sha256 "abc" is not a hex SHA-256 digest (fingerprint)`,
+		`test.bib:24: size "large" is not a number of bytes (fingerprint)`,
+		`test.bib:27: duplicate key "proc" (previously defined at line 19) (duplicate-key)`,
+		`test.bib:27: unknown entry type "unknown" (type)`,
+	}
+
+	err = Lint(f, nil)
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected error list; got %v", err)
+	}
+	for i, err := range errs {
+		t.Log(err)
+		if i >= len(expect) || err.Error() != expect[i] {
+			t.Errorf("error %d: unexpected %q", i, err)
+		}
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("got %d errors; expect %d", len(errs), len(expect))
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	src := `@article{article,
+    title   = "Title",
+    author  = "Gopher, Go",
+    journal = "Journal",
+    year    = 2020,
+    pages   = "1--10",
+    custom  = "value",
+}
+`
+	f, err := ParseBibFile("test.bib", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name   string
+		Config string
+		Expect string
+	}{
+		{
+			Name:   "default",
+			Expect: `test.bib:7: unknown field "custom" for article entry (unknown-field)`,
+		},
+		{
+			Name:   "disable",
+			Config: "# Comment.\ndisable unknown-field\n",
+		},
+		{
+			Name:   "allow",
+			Config: "allow custom\n",
+		},
+		{
+			Name:   "require",
+			Config: "allow custom\nrequire article doi\n",
+			Expect: `test.bib:1: article "article": missing required field "doi" (required)`,
+		},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			config, err := ParseLintConfig("biblint", []byte(c.Config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if err := Lint(f, config); err != nil {
+				got = err.Error()
+			}
+			if got != c.Expect {
+				t.Fatalf("got %q; expect %q", got, c.Expect)
+			}
+		})
+	}
+}
+
+func TestParseLintConfigErrors(t *testing.T) {
+	cases := map[string]string{
+		"disable unknown\n":   `biblint:1: unknown rule "unknown"`,
+		"\nrequire article\n": `biblint:2: invalid directive "require article"`,
+		"enable url\n":        `biblint:1: invalid directive "enable url"`,
+	}
+	for src, expect := range cases {
+		_, err := ParseLintConfig("biblint", []byte(src))
+		if err == nil || err.Error() != expect {
+			t.Errorf("ParseLintConfig(%q) error = %v; expect %q", src, err, expect)
+		}
+	}
+}
@@ -11,9 +11,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/google/subcommands"
+	"github.com/pkg/diff"
 )
 
 func main() {
@@ -27,7 +30,9 @@ func main1() int {
 	subcommands.Register(&process{command: base}, "")
 	subcommands.Register(&generate{command: base}, "")
 	subcommands.Register(&format{command: base}, "")
+	subcommands.Register(&lint{command: base}, "")
 	subcommands.Register(&linkcheck{command: base}, "")
+	subcommands.Register(&unused{command: base}, "")
 	subcommands.Register(subcommands.HelpCommand(), "")
 
 	flag.Parse()
@@ -57,87 +62,239 @@ func (c command) Error(err error) subcommands.ExitStatus {
 	return c.Fail(err.Error())
 }
 
+// Report logs each error in the list without the log prefix, so that
+// "file:line:col: message" diagnostics are recognized by editors and CI tools.
+func (c command) Report(errs ErrorList) {
+	for _, err := range errs {
+		fmt.Fprintln(c.Log.Writer(), err)
+	}
+}
+
+// stringList is a flag value that may be given multiple times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// bibliographyFlags locates and loads bibliography files for subcommands.
+type bibliographyFlags struct {
+	bibfiles stringList
+	name     string
+
+	cache map[string]*Bibliography
+}
+
+// SetFlags registers bibliography flags.
+func (b *bibliographyFlags) SetFlags(f *flag.FlagSet) {
+	f.Var(&b.bibfiles, "bib", "bibliography `file`, optionally a glob prefixed with \"<namespace>=\" (may be repeated; default search parent directories)")
+	f.StringVar(&b.name, "bibname", DefaultBibliographyName, "bibliography filename to search for when -bib is not provided")
+}
+
+// Files returns the bibliography files that apply to source files in dir.
+// These are the explicitly provided files if there are any, otherwise the
+// nearest bibliography found in dir or its parents.
+func (b *bibliographyFlags) Files(dir string) ([]BibliographyFile, error) {
+	if len(b.bibfiles) > 0 {
+		return ParseBibliographyFiles(b.bibfiles)
+	}
+
+	path, err := FindBibliography(dir, b.name)
+	if err != nil {
+		return nil, err
+	}
+
+	return []BibliographyFile{{Path: path}}, nil
+}
+
+// Load the merged bibliography that applies to source files in dir.
+func (b *bibliographyFlags) Load(dir string) (*Bibliography, error) {
+	files, err := b.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprint(files)
+	if bib, ok := b.cache[key]; ok {
+		return bib, nil
+	}
+
+	bib, err := ReadBibliographies(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.cache == nil {
+		b.cache = map[string]*Bibliography{}
+	}
+	b.cache[key] = bib
+
+	return bib, nil
+}
+
+// styleFlags selects the citation style for subcommands.
+type styleFlags struct {
+	name string
+	etal int
+}
+
+// SetFlags registers style flags.
+func (s *styleFlags) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&s.name, "style", "default", fmt.Sprintf(`citation style (possible values: "%s")`, strings.Join(BuiltinStyleNames(), `", "`)))
+	f.IntVar(&s.etal, "etal", 0, "list at most `n` authors before \"et al.\" (0 for no limit)")
+}
+
+// Style returns the selected style.
+func (s *styleFlags) Style() (Style, error) {
+	style, err := LookupStyle(s.name)
+	if err != nil {
+		return nil, err
+	}
+	if s.etal > 0 {
+		style = EtAl(style, s.etal)
+	}
+	return style, nil
+}
+
 // process subcommand.
 type process struct {
 	command
 
-	bibfile string
-	write   bool
+	bib   bibliographyFlags
+	style styleFlags
+	write bool
+	list  bool
+	diff  bool
+	check bool
 }
 
 func (*process) Name() string     { return "process" }
 func (*process) Synopsis() string { return "generate bibliography comments" }
 func (*process) Usage() string {
-	return `Usage: bib process [-w] -bib <bibfile> <source> ...
+	return `Usage: bib process [-w] [-l] [-d] [-check] [-style <style>] [-etal <n>] [-bib <bibfile>] <source|package> ...
 
-Generate references comments for citations in given source files.
+Generate references comments for citations in given source files. Arguments
+may also be package directories or patterns such as "./...".
+
+The -l and -d flags report files whose references comments would change,
+rather than printing the result. The -check flag exits with failure status if
+any file would change.
 
 `
 }
 
 func (cmd *process) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&cmd.bibfile, "bib", "", "bibliography file")
+	cmd.bib.SetFlags(f)
+	cmd.style.SetFlags(f)
 	f.BoolVar(&cmd.write, "w", false, "write result to (source) files instead of stdout")
+	f.BoolVar(&cmd.list, "l", false, "list files whose references differ")
+	f.BoolVar(&cmd.diff, "d", false, "display diffs instead of rewriting files")
+	f.BoolVar(&cmd.check, "check", false, "exit with failure status if any references are stale")
 }
 
 func (cmd *process) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	if cmd.bibfile == "" {
-		return cmd.UsageError("must provide bibliography file")
+	style, err := cmd.style.Style()
+	if err != nil {
+		return cmd.UsageError(err.Error())
 	}
 
-	b, err := ReadBibliography(cmd.bibfile)
+	filenames, err := SourceFiles(f.Args())
 	if err != nil {
 		return cmd.Error(err)
 	}
 
-	for _, filename := range f.Args() {
-		if err := cmd.file(filename, b); err != nil {
+	status := subcommands.ExitSuccess
+	for _, filename := range filenames {
+		b, err := cmd.bib.Load(filepath.Dir(filename))
+		if err != nil {
+			return cmd.Error(err)
+		}
+
+		changed, err := cmd.file(filename, b, style)
+		var errs ErrorList
+		if errors.As(err, &errs) {
+			cmd.Report(errs)
+			status = subcommands.ExitFailure
+			continue
+		}
+		if err != nil {
 			return cmd.Error(err)
 		}
+		if changed && cmd.check {
+			cmd.Log.Printf("stale references: %s", filename)
+			status = subcommands.ExitFailure
+		}
 	}
 
-	return subcommands.ExitSuccess
+	return status
 }
 
-// file processes a single file.
-func (cmd *process) file(filename string, b *Bibliography) error {
-	s, err := ParseFile(filename)
+// file processes a single file, and reports whether the file would change.
+func (cmd *process) file(filename string, b *Bibliography, style Style) (bool, error) {
+	src, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return err
+		return false, err
 	}
 
+	s, err := Parse(filename, src)
+	if err != nil {
+		return false, err
+	}
+	s.Style = style
+
 	if err := s.Validate(b); err != nil {
-		return err
+		return false, err
 	}
 
 	out, err := s.Bytes(b)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if cmd.write {
-		err = ioutil.WriteFile(filename, out, 0o644)
-	} else {
+	changed := !bytes.Equal(src, out)
+
+	if cmd.list && changed {
+		if _, err := fmt.Println(filename); err != nil {
+			return false, err
+		}
+	}
+
+	if cmd.diff && changed {
+		if err := diff.Text(filename+".orig", filename, src, out, os.Stdout); err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case cmd.write:
+		if changed {
+			err = ioutil.WriteFile(filename, out, 0o644)
+		}
+	case !cmd.list && !cmd.diff && !cmd.check:
 		_, err = os.Stdout.Write(out)
 	}
 
-	return err
+	return changed, err
 }
 
 // generate subcommand.
 type generate struct {
 	command
 
-	bibfile string
-	typ     string
-	tmpl    string
-	output  string
+	bib    bibliographyFlags
+	style  styleFlags
+	typ    string
+	tmpl   string
+	output string
 }
 
 func (*generate) Name() string     { return "generate" }
 func (*generate) Synopsis() string { return "generate templated output" }
 func (*generate) Usage() string {
-	return `Usage: bib generate -bib <bibfile> [-tmpl <template>] [-output <file>]
+	return `Usage: bib generate [-bib <bibfile>] [-style <style>] [-etal <n>] [-tmpl <template>] [-output <file>]
 
 Generate templated output from BibTeX bibliography.
 
@@ -145,18 +302,20 @@ Generate templated output from BibTeX bibliography.
 }
 
 func (cmd *generate) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&cmd.bibfile, "bib", "", "bibliography file")
+	cmd.bib.SetFlags(f)
+	cmd.style.SetFlags(f)
 	f.StringVar(&cmd.typ, "type", "", fmt.Sprintf(`name of a builtin template (possible values: "%s")`, strings.Join(BuiltinTemplateNames(), `", "`)))
 	f.StringVar(&cmd.tmpl, "tmpl", "", "template file (overrides type)")
 	f.StringVar(&cmd.output, "output", "", "output file (default stdout)")
 }
 
 func (cmd *generate) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	if cmd.bibfile == "" {
-		return cmd.UsageError("must provide bibliography file")
+	style, err := cmd.style.Style()
+	if err != nil {
+		return cmd.UsageError(err.Error())
 	}
 
-	b, err := ReadBibliography(cmd.bibfile)
+	b, err := cmd.bib.Load(".")
 	if err != nil {
 		return cmd.Error(err)
 	}
@@ -169,7 +328,7 @@ func (cmd *generate) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{
 
 	// Generate output.
 	var buf bytes.Buffer
-	if err := Generate(&buf, tmpl, b); err != nil {
+	if err := Generate(&buf, tmpl, b, style); err != nil {
 		return cmd.Error(err)
 	}
 
@@ -212,98 +371,730 @@ func (cmd *generate) load() (string, error) {
 	return s, nil
 }
 
+// formatFlags configures the BibTeX output style for subcommands.
+type formatFlags struct {
+	indent        string
+	align         bool
+	delim         string
+	trailingComma bool
+	typeCase      string
+	fields        string
+	sort          string
+}
+
+// SetFlags registers format flags.
+func (o *formatFlags) SetFlags(f *flag.FlagSet) {
+	d := DefaultFormatOptions
+	f.StringVar(&o.indent, "indent", strconv.Itoa(len(d.Indent)), "indent fields by `n` spaces, or \"tab\"")
+	f.BoolVar(&o.align, "align", d.Align, "align \"=\" signs of fields")
+	f.StringVar(&o.delim, "delim", "quotes", `value delimiters (possible values: "quotes", "braces")`)
+	f.BoolVar(&o.trailingComma, "trailingcomma", d.TrailingComma, "write a comma after the last field")
+	f.StringVar(&o.typeCase, "typecase", "lower", `case of entry types (possible values: "lower", "preserve")`)
+	f.StringVar(&o.fields, "fields", strings.Join(d.FieldOrder, ","), "comma-separated `list` of fields to place first")
+	f.StringVar(&o.sort, "sort", "key", fmt.Sprintf(`entry order (possible values: "%s")`, strings.Join(EntryOrderNames(), `", "`)))
+}
+
+// Options returns the selected format options.
+func (o *formatFlags) Options() (FormatOptions, error) {
+	var opts FormatOptions
+
+	switch n, err := strconv.Atoi(o.indent); {
+	case o.indent == "tab":
+		opts.Indent = "\t"
+	case err == nil && n >= 0:
+		opts.Indent = strings.Repeat(" ", n)
+	default:
+		return FormatOptions{}, fmt.Errorf("invalid indent %q", o.indent)
+	}
+
+	opts.Align = o.align
+
+	switch o.delim {
+	case "quotes":
+	case "braces":
+		opts.Braces = true
+	default:
+		return FormatOptions{}, fmt.Errorf("unknown delimiter %q", o.delim)
+	}
+
+	opts.TrailingComma = o.trailingComma
+
+	switch o.typeCase {
+	case "lower":
+	case "preserve":
+		opts.PreserveType = true
+	default:
+		return FormatOptions{}, fmt.Errorf("unknown type case %q", o.typeCase)
+	}
+
+	for _, name := range strings.Split(o.fields, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			opts.FieldOrder = append(opts.FieldOrder, name)
+		}
+	}
+
+	order, err := LookupEntryOrder(o.sort)
+	if err != nil {
+		return FormatOptions{}, err
+	}
+	opts.Sort = order
+
+	return opts, nil
+}
+
 // format subcommand.
 type format struct {
 	command
 
-	bibfile string
-	write   bool
+	bib    bibliographyFlags
+	format formatFlags
+	write  bool
+	check  bool
 }
 
 func (*format) Name() string     { return "fmt" }
 func (*format) Synopsis() string { return "format bibtex file" }
 func (*format) Usage() string {
-	return `Usage: bib fmt [-w] -bib <bibfile>
+	return `Usage: bib fmt [-w] [-check] [-sort <order>] [-indent <n>] [-align] [-delim <delim>]
+               [-trailingcomma] [-typecase <case>] [-fields <list>] [-bib <bibfile>]
 
-Format BiBTeX file.
+Format BiBTeX file. Comments, @comment, @preamble and @string blocks are
+kept in place, and entries are sorted within the sections between them.
+Use "-sort none" to keep the order of entries as written.
+
+The output style flags allow a project's house style to be enforced, for
+example with "-check" in continuous integration. Boolean flags may be
+disabled with "-align=false".
 
 `
 }
 
 func (cmd *format) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&cmd.bibfile, "bib", "", "bibliography file")
+	cmd.bib.SetFlags(f)
+	cmd.format.SetFlags(f)
 	f.BoolVar(&cmd.write, "w", false, "write result to (source) files instead of stdout")
+	f.BoolVar(&cmd.check, "check", false, "exit with failure status if any file is not formatted")
 }
 
 func (cmd *format) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	if cmd.bibfile == "" {
-		return cmd.UsageError("must provide bibliography file")
+	opts, err := cmd.format.Options()
+	if err != nil {
+		return cmd.UsageError(err.Error())
 	}
 
-	b, err := ReadBibliography(cmd.bibfile)
+	files, err := cmd.bib.Files(".")
 	if err != nil {
 		return cmd.Error(err)
 	}
 
+	status := subcommands.ExitSuccess
+	for _, file := range files {
+		changed, err := cmd.file(file.Path, opts)
+		if err != nil {
+			return cmd.Error(err)
+		}
+		if changed && cmd.check {
+			cmd.Log.Printf("not formatted: %s", file.Path)
+			status = subcommands.ExitFailure
+		}
+	}
+
+	return status
+}
+
+// file formats a single bibliography file, and reports whether the file
+// would change.
+func (cmd *format) file(bibfile string, opts FormatOptions) (bool, error) {
+	src, err := ioutil.ReadFile(bibfile)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := ParseBibFile(bibfile, src)
+	if err != nil {
+		return false, err
+	}
+
 	// Format and output.
-	formatted := FormatBibTeX(b)
+	formatted := FormatBibTeX(f, opts)
+	changed := !bytes.Equal(src, formatted)
 
-	if cmd.write {
-		err = ioutil.WriteFile(cmd.bibfile, formatted, 0o644)
-	} else {
+	switch {
+	case cmd.write:
+		if changed {
+			err = ioutil.WriteFile(bibfile, formatted, 0o644)
+		}
+	case !cmd.check:
 		_, err = os.Stdout.Write(formatted)
 	}
 
+	return changed, err
+}
+
+// lint subcommand.
+type lint struct {
+	command
+
+	bib     bibliographyFlags
+	config  string
+	disable stringList
+}
+
+func (*lint) Name() string     { return "lint" }
+func (*lint) Synopsis() string { return "check bibtex entries for problems" }
+func (*lint) Usage() string {
+	return `Usage: bib lint [-config <file>] [-disable <rule>] [-bib <bibfile>]
+
+Check every entry of the BibTeX file for missing required fields, unknown
+fields and types, duplicate fields and keys, and invalid years, dates and
+URLs. Problems are reported with their file and line.
+
+Rules may be configured with a file, by default ".biblint" next to each
+bibliography file, containing directives such as:
+
+	# Comment.
+	disable unknown-field
+	allow keywords timestamp
+	require article doi
+
+`
+}
+
+func (cmd *lint) SetFlags(f *flag.FlagSet) {
+	cmd.bib.SetFlags(f)
+	f.StringVar(&cmd.config, "config", "", "lint configuration `file` (default \".biblint\" next to the bibliography)")
+	f.Var(&cmd.disable, "disable", fmt.Sprintf("disable `rule` (may be repeated; possible values: \"%s\")", strings.Join(LintRuleNames(), `", "`)))
+}
+
+func (cmd *lint) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	for _, rule := range cmd.disable {
+		if _, ok := lintRules[rule]; !ok {
+			return cmd.UsageError("unknown rule %q", rule)
+		}
+	}
+
+	files, err := cmd.bib.Files(".")
 	if err != nil {
 		return cmd.Error(err)
 	}
 
-	return subcommands.ExitSuccess
+	status := subcommands.ExitSuccess
+	for _, file := range files {
+		err := cmd.file(file.Path)
+		var errs ErrorList
+		if errors.As(err, &errs) {
+			cmd.Report(errs)
+			status = subcommands.ExitFailure
+			continue
+		}
+		if err != nil {
+			return cmd.Error(err)
+		}
+	}
+
+	return status
+}
+
+// file lints a single bibliography file.
+func (cmd *lint) file(bibfile string) error {
+	config, err := cmd.load(bibfile)
+	if err != nil {
+		return err
+	}
+	for _, rule := range cmd.disable {
+		config.Disabled[rule] = true
+	}
+
+	f, err := ReadBibFile(bibfile)
+	if err != nil {
+		return err
+	}
+
+	return Lint(f, config)
+}
+
+// load the lint configuration for a bibliography file.
+func (cmd *lint) load(bibfile string) (*LintConfig, error) {
+	if cmd.config != "" {
+		return ReadLintConfig(cmd.config)
+	}
+
+	path := filepath.Join(filepath.Dir(bibfile), ".biblint")
+	if _, err := os.Stat(path); err != nil {
+		return ParseLintConfig(path, nil)
+	}
+	return ReadLintConfig(path)
 }
 
 // linkcheck subcommand.
 type linkcheck struct {
 	command
 
-	bibfile string
+	bib     bibliographyFlags
+	format  formatFlags
+	checker *LinkChecker
+	cache   string
+	archive string
+	fix     bool
+	record  bool
 	verbose bool
 }
 
 func (*linkcheck) Name() string     { return "linkcheck" }
 func (*linkcheck) Synopsis() string { return "check whether all urls exist" }
 func (*linkcheck) Usage() string {
-	return `Usage: bib linkcheck [-v] -bib <bibfile>
+	return `Usage: bib linkcheck [-v] [-j <n>] [-perhost <n>] [-delay <duration>] [-timeout <duration>] [-retries <n>]
+                     [-cache <file>] [-max-age <duration>] [-archive <url>] [-fix] [-record]
+                     [-fragments] [-bib <bibfile>] [<source|package> ...]
 
-Check whether all URLs in the database exist.
+Check whether all URLs in the database exist. Links are checked concurrently,
+with limits on the requests made to each host. A HEAD request is tried first,
+falling back to GET. Requests that fail with status 429 or 5xx are retried
+with exponential backoff, honouring any Retry-After header.
+
+Results are recorded in a cache file. Links verified within the -max-age
+duration are not checked again, and others are revalidated with conditional
+requests using the recorded ETag and Last-Modified headers. Use -cache ""
+to disable the cache.
+
+If the url of an entry fails, its mirror and archiveurl fields are tried,
+along with its snapshot in a web archive if -archive gives the base URL of
+one, such as ` + DefaultArchive + `. The entry is then reported with a
+warning rather than an error if any of these works.
+
+With -fragments, the fragment of a link to an HTML document must be the id or
+name of an element, and a "page=N" fragment of a link to a PDF document must
+not exceed its page count. Anchors created by scripts cannot be found, and
+PDF documents whose page count cannot be determined are not checked.
+
+Redirect chains that include a permanent move (301 or 308) are reported, and
+all redirect chains with -v. The -fix flag rewrites url fields to the
+destination of their permanent redirects, or from http to https where that
+works, and writes the bibliography in the style given by the same flags as
+"bib fmt".
+
+Entries may record a fingerprint of the content at their url in sha256, etag
+and size fields. The live content is compared against it, and any drift is
+reported as a failure. The -record flag adds the fingerprint fields that are
+missing, in the same way as -fix.
+
+Given source files, package directories or patterns such as "./...", the
+bare URLs in comments are checked instead of the database, and the position
+of every broken link is reported. URLs in references blocks are skipped,
+since they come from the database.
 
 `
 }
 
 func (cmd *linkcheck) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&cmd.bibfile, "bib", "", "bibliography file")
+	cmd.bib.SetFlags(f)
+	cmd.checker = NewLinkChecker()
 	f.BoolVar(&cmd.verbose, "v", false, "verbose output")
+	f.IntVar(&cmd.checker.Workers, "j", cmd.checker.Workers, "check `n` links concurrently")
+	f.IntVar(&cmd.checker.PerHost, "perhost", cmd.checker.PerHost, "at most `n` concurrent requests to each host (0 for no limit)")
+	f.DurationVar(&cmd.checker.Delay, "delay", cmd.checker.Delay, "minimum `duration` between requests to each host")
+	f.DurationVar(&cmd.checker.Timeout, "timeout", cmd.checker.Timeout, "timeout for each request (0 for no timeout)")
+	f.IntVar(&cmd.checker.Retries, "retries", cmd.checker.Retries, "retry failed requests up to `n` times")
+	f.StringVar(&cmd.cache, "cache", DefaultLinkCachePath(), "cache `file` for link check results")
+	f.DurationVar(&cmd.checker.MaxAge, "max-age", 0, "skip links verified within `duration`")
+	f.StringVar(&cmd.archive, "archive", "", "base `url` of a web archive to look up snapshots of failed links")
+	f.BoolVar(&cmd.fix, "fix", false, "rewrite redirected and http urls in the bibliography file")
+	f.BoolVar(&cmd.record, "record", false, "add missing fingerprint fields to the bibliography file")
+	f.BoolVar(&cmd.checker.Fragments, "fragments", cmd.checker.Fragments, "check that url fragments exist in html and pdf content")
+	cmd.format.SetFlags(f)
 }
 
-func (cmd *linkcheck) Execute(ctx context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	if cmd.bibfile == "" {
-		return cmd.UsageError("must provide bibliography file")
+func (cmd *linkcheck) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	opts, err := cmd.format.Options()
+	if err != nil {
+		return cmd.UsageError(err.Error())
+	}
+	if f.NArg() > 0 && (cmd.fix || cmd.record) {
+		return cmd.UsageError("-fix and -record only apply to the bibliography")
+	}
+
+	// An unreadable cache only costs rechecking the links, as does one that
+	// cannot be saved below.
+	if cmd.cache != "" {
+		cmd.checker.Cache, err = OpenLinkCache(cmd.cache)
+		if err != nil {
+			cmd.Log.Printf("warning: ignoring unreadable cache: %s", err)
+			cmd.checker.Cache = NewLinkCache(cmd.cache)
+		}
 	}
 
-	b, err := ReadBibliography(cmd.bibfile)
+	var failed bool
+	if f.NArg() > 0 {
+		failed, err = cmd.sources(ctx, f.Args())
+	} else {
+		failed, err = cmd.bibliography(ctx, opts)
+	}
 	if err != nil {
 		return cmd.Error(err)
 	}
 
+	if cmd.checker.Cache != nil {
+		if err := cmd.checker.Cache.Save(); err != nil {
+			cmd.Log.Printf("warning: could not save cache: %s", err)
+		}
+	}
+
+	if failed {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// bibliography checks the URLs in the bibliography. Reports whether any link
+// failed.
+func (cmd *linkcheck) bibliography(ctx context.Context, opts FormatOptions) (bool, error) {
+	b, err := cmd.bib.Load(".")
+	if err != nil {
+		return false, err
+	}
+
 	// Check all URLs.
-	status := subcommands.ExitSuccess
-	for _, link := range Links(b) {
-		if err := CheckLink(ctx, link); err != nil {
-			cmd.Log.Printf("error: %s: %s", link, err)
-			status = subcommands.ExitFailure
-		} else if cmd.verbose {
-			cmd.Log.Printf("ok: %s", link)
+	failed := false
+	results := cmd.checker.Check(ctx, Links(b))
+
+	// Check the alternative locations of links that failed.
+	fallbacks := Fallbacks(b, cmd.archive)
+	var alternatives []string
+	for _, result := range results {
+		if result.Err != nil {
+			alternatives = append(alternatives, fallbacks[result.URL]...)
+		}
+	}
+	working := map[string]bool{}
+	for _, result := range cmd.checker.Check(ctx, alternatives) {
+		working[result.URL] = result.Err == nil
+	}
+	fallback := func(link string) string {
+		for _, alternative := range fallbacks[link] {
+			if working[alternative] {
+				return alternative
+			}
 		}
+		return ""
 	}
 
-	return status
+	for _, result := range results {
+		switch {
+		case result.Err != nil && fallback(result.URL) != "":
+			cmd.Log.Printf("warning: %s: %s (fallback ok: %s)", result.URL, result.Err, fallback(result.URL))
+		case result.Err != nil:
+			cmd.Log.Printf("error: %s: %s", result.URL, result.Err)
+			failed = true
+		case cmd.verbose && result.Cached:
+			cmd.Log.Printf("ok (cached): %s", result.URL)
+		case cmd.verbose:
+			cmd.Log.Printf("ok: %s", result.URL)
+		}
+
+		if len(result.Redirects) > 0 && (cmd.verbose || result.Permanent() != "") {
+			chain := []string{result.URL}
+			for _, redirect := range result.Redirects {
+				chain = append(chain, redirect.String())
+			}
+			cmd.Log.Printf("redirect: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	drifted, err := cmd.fingerprints(ctx, b, results, opts)
+	if err != nil {
+		return false, err
+	}
+
+	if cmd.fix {
+		if err := cmd.rewrite(ctx, results, opts); err != nil {
+			return false, err
+		}
+	}
+
+	return failed || drifted, nil
+}
+
+// sources checks the URLs in comments of the given source files, reporting the
+// position of every occurrence of a broken link. Reports whether any link
+// failed.
+func (cmd *linkcheck) sources(ctx context.Context, args []string) (bool, error) {
+	filenames, err := SourceFiles(args)
+	if err != nil {
+		return false, err
+	}
+
+	var occurrences []SourceLink
+	var links []string
+	seen := map[string]bool{}
+	for _, filename := range filenames {
+		s, err := ParseFile(filename)
+		if err != nil {
+			return false, err
+		}
+		for _, link := range s.Links {
+			occurrences = append(occurrences, link)
+			if !seen[link.URL] {
+				links = append(links, link.URL)
+				seen[link.URL] = true
+			}
+		}
+	}
+
+	broken := map[string]error{}
+	for _, result := range cmd.checker.Check(ctx, links) {
+		switch {
+		case result.Err != nil:
+			broken[result.URL] = result.Err
+		case cmd.verbose && result.Cached:
+			cmd.Log.Printf("ok (cached): %s", result.URL)
+		case cmd.verbose:
+			cmd.Log.Printf("ok: %s", result.URL)
+		}
+	}
+
+	var errs ErrorList
+	for _, link := range occurrences {
+		if err, ok := broken[link.URL]; ok {
+			errs = append(errs, BrokenLinkError{SourceLink: link, Err: err})
+		}
+	}
+	cmd.Report(errs)
+
+	return len(errs) > 0, nil
+}
+
+// fingerprints compares the fingerprints recorded by entries with the live
+// content at their url, and with -record adds those that are missing. Reports
+// whether any content drifted or could not be fetched.
+func (cmd *linkcheck) fingerprints(ctx context.Context, b *Bibliography, results []LinkResult, opts FormatOptions) (bool, error) {
+	working := map[string]bool{}
+	for _, result := range results {
+		working[result.URL] = result.Err == nil
+	}
+
+	// Fetch content for working links that have a fingerprint, or that
+	// should have one recorded.
+	var entries []*Entry
+	var links []string
+	seen := map[string]bool{}
+	for _, e := range b.Entries {
+		link := e.Field("url")
+		if !working[link] || (e.Fingerprint().IsZero() && !cmd.record) {
+			continue
+		}
+		entries = append(entries, e)
+		if !seen[link] {
+			links = append(links, link)
+			seen[link] = true
+		}
+	}
+
+	fingerprints, errs := cmd.checker.FetchFingerprints(ctx, links)
+	failed := false
+	for _, link := range links {
+		if err, ok := errs[link]; ok {
+			cmd.Log.Printf("error: %s: fingerprint: %s", link, err)
+			failed = true
+		}
+	}
+
+	// Report drift.
+	for _, e := range entries {
+		link := e.Field("url")
+		live, ok := fingerprints[link]
+		if !ok {
+			continue
+		}
+		if diffs := e.Fingerprint().Drift(live); len(diffs) > 0 {
+			cmd.Log.Printf("drift: %s: %s: %s", e.Position(), link, strings.Join(diffs, ", "))
+			failed = true
+		}
+	}
+
+	if !cmd.record {
+		return failed, nil
+	}
+
+	return failed, cmd.edit(opts, func(path string, f *BibFile) bool {
+		keys := RecordFingerprints(f, fingerprints)
+		for _, key := range keys {
+			cmd.Log.Printf("record: %s: %s", path, key)
+		}
+		return len(keys) > 0
+	})
+}
+
+// rewrite url fields in the bibliography files to the destination of their
+// permanent redirects, or to https where that works.
+func (cmd *linkcheck) rewrite(ctx context.Context, results []LinkResult, opts FormatOptions) error {
+	replace := cmd.checker.Destinations(ctx, results)
+	return cmd.edit(opts, func(path string, f *BibFile) bool {
+		fixes := RewriteURLs(f, replace)
+		for _, fix := range fixes {
+			cmd.Log.Printf("fix: %s:%d: %s -> %s", path, fix.Line, fix.Old, fix.New)
+		}
+		return len(fixes) > 0
+	})
+}
+
+// edit applies a change to each bibliography file, and writes back the files
+// that changed in the given format.
+func (cmd *linkcheck) edit(opts FormatOptions, change func(path string, f *BibFile) bool) error {
+	files, err := cmd.bib.Files(".")
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		f, err := ReadBibFile(file.Path)
+		if err != nil {
+			return err
+		}
+
+		if change(file.Path, f) {
+			if err := ioutil.WriteFile(file.Path, FormatBibTeX(f, opts), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unused subcommand.
+type unused struct {
+	command
+
+	bib    bibliographyFlags
+	format formatFlags
+	write  bool
+}
+
+func (*unused) Name() string     { return "unused" }
+func (*unused) Synopsis() string { return "report bibliography entries that are not cited" }
+func (*unused) Usage() string {
+	return `Usage: bib unused [-w] [-bib <bibfile>] <source|package> ...
+
+Report bibliography entries that are not cited in any of the given source
+files. Arguments may also be package directories or patterns such as "./...".
+
+With -w the pruned bibliography is written in the style given by the same
+flags as "bib fmt".
+
+`
+}
+
+func (cmd *unused) SetFlags(f *flag.FlagSet) {
+	cmd.bib.SetFlags(f)
+	cmd.format.SetFlags(f)
+	f.BoolVar(&cmd.write, "w", false, "remove unused entries from the bibliography file")
+}
+
+func (cmd *unused) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	opts, err := cmd.format.Options()
+	if err != nil {
+		return cmd.UsageError(err.Error())
+	}
+
+	// Without sources every entry would be reported unused, and pruned with -w.
+	if f.NArg() == 0 {
+		return cmd.UsageError("must provide source files or packages")
+	}
+
+	filenames, err := SourceFiles(f.Args())
+	if err != nil {
+		return cmd.Error(err)
+	}
+
+	// Collect citations from all files, and the bibliographies that apply to
+	// them.
+	cited := map[string]bool{}
+	bibfiles := []BibliographyFile{}
+	seen := map[BibliographyFile]bool{}
+	for _, filename := range filenames {
+		s, err := ParseFile(filename)
+		if err != nil {
+			return cmd.Error(err)
+		}
+		for key := range s.Citations {
+			cited[key] = true
+		}
+
+		files, err := cmd.bib.Files(filepath.Dir(filename))
+		if err != nil {
+			return cmd.Error(err)
+		}
+		for _, file := range files {
+			if !seen[file] {
+				bibfiles = append(bibfiles, file)
+				seen[file] = true
+			}
+		}
+	}
+
+	if len(bibfiles) == 0 {
+		bibfiles, err = cmd.bib.Files(".")
+		if err != nil {
+			return cmd.Error(err)
+		}
+	}
+
+	for _, bibfile := range bibfiles {
+		if err := cmd.bibliography(bibfile, cited, opts); err != nil {
+			return cmd.Error(err)
+		}
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// bibliography reports or prunes entries in the bibliography file that are
+// not cited.
+func (cmd *unused) bibliography(file BibliographyFile, cited map[string]bool, opts FormatOptions) error {
+	f, err := ReadBibFile(file.Path)
+	if err != nil {
+		return err
+	}
+
+	b, err := f.Bibliography()
+	if err != nil {
+		return err
+	}
+
+	// Entries referenced by the crossref field of a cited entry are used.
+	used := map[string]bool{}
+	for _, e := range b.Entries {
+		key := e.CiteName
+		if file.Namespace != "" {
+			key = file.Namespace + ":" + key
+		}
+		if cited[key] {
+			used[e.CiteName] = true
+			if ref, ok := e.Fields["crossref"]; ok {
+				used[ref.String()] = true
+			}
+		}
+	}
+
+	// Either prune the bibliography or report unused entries.
+	pruned := &BibFile{Filename: f.Filename}
+	for _, block := range f.Blocks {
+		key := block.Key
+		if file.Namespace != "" {
+			key = file.Namespace + ":" + key
+		}
+
+		switch {
+		case block.Kind != EntryBlock || used[block.Key]:
+			pruned.Blocks = append(pruned.Blocks, block)
+		case !cmd.write:
+			fmt.Println(key)
+		}
+	}
+
+	if cmd.write {
+		return ioutil.WriteFile(file.Path, FormatBibTeX(pruned, opts), 0o644)
+	}
+
+	return nil
 }
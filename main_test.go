@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/rogpeppe/go-internal/testenv"
@@ -22,6 +25,21 @@ func TestMain(m *testing.M) {
 func TestScripts(t *testing.T) {
 	testscript.Run(t, testscript.Params{
 		Dir: filepath.Join("testdata", "scripts"),
+		Setup: func(env *testscript.Env) error {
+			// Local stand-in for web servers. Paths under /archive/ are
+			// snapshots, which exist for URLs ending in "archived".
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/ok":
+				case strings.HasPrefix(r.URL.Path, "/archive/") && strings.HasSuffix(r.URL.Path, "archived"):
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			env.Setenv("SERVER", srv.URL)
+			env.Defer(srv.Close)
+			return nil
+		},
 		Condition: func(cond string) (bool, error) {
 			switch cond {
 			case "network":
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Person is a name parsed according to the BibTeX rules. Each part retains
+// any LaTeX markup from the bibliography.
+type Person struct {
+	First string
+	Von   string
+	Last  string
+	Jr    string
+}
+
+// others is the name BibTeX uses to indicate a truncated list of names.
+const others = "others"
+
+// Others is the person marking a truncated list of names, written "and
+// others" in BibTeX.
+var Others = Person{Last: others}
+
+// IsOthers reports whether p marks a truncated list of names.
+func (p Person) IsOthers() bool {
+	return p == Others
+}
+
+// String returns the full name with LaTeX markup decoded.
+func (p Person) String() string {
+	return p.Format(NameFormat{}, PlainText)
+}
+
+// Format renders the name with the given markup. Only the Initials and
+// Inverted options of the name format apply.
+func (p Person) Format(f NameFormat, m Markup) string {
+	first := DecodeLaTeX(p.First, m)
+	if f.Initials {
+		first = m.Text(initials(DecodeLaTeX(p.First, PlainText)))
+	}
+	last := DecodeLaTeX(join(" ", p.Von, p.Last), m)
+	jr := DecodeLaTeX(p.Jr, m)
+
+	if f.Inverted {
+		return join(", ", last, jr, first)
+	}
+	return join(", ", join(" ", first, last), jr)
+}
+
+// initials abbreviates names to their initials. Hyphenated names keep the
+// hyphen, so "Jean-Paul" becomes "J.-P.".
+func initials(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		parts := strings.Split(word, "-")
+		for j, part := range parts {
+			if r, _ := utf8.DecodeRuneInString(part); r != utf8.RuneError {
+				parts[j] = string(r) + "."
+			}
+		}
+		words[i] = strings.Join(parts, "-")
+	}
+	return strings.Join(words, " ")
+}
+
+// NameFormat describes how a list of names is rendered.
+type NameFormat struct {
+	// Initials abbreviates first names, as in "D. E. Knuth".
+	Initials bool
+
+	// Inverted places the last name first, as in "Knuth, D. E.".
+	Inverted bool
+
+	// Conjunction before the last name. Defaults to "and".
+	Conjunction string
+
+	// Serial adds a comma before the conjunction in lists of three or more.
+	Serial bool
+}
+
+// FormatAuthors formats a list of authors in a readable form. Lists that end
+// with Others are truncated with "et al.". Use the EtAl style to limit the
+// number of authors.
+func FormatAuthors(authors []Person, f NameFormat, m Markup) string {
+	names := []string{}
+	etal := false
+	for _, p := range authors {
+		if p.IsOthers() {
+			etal = true
+			break
+		}
+		names = append(names, p.Format(f, m))
+	}
+
+	if etal {
+		return join(" ", strings.Join(names, ", "), "et al.")
+	}
+
+	conj := f.Conjunction
+	if conj == "" {
+		conj = "and"
+	}
+	return joinAuthors(names, conj, f.Serial)
+}
+
+// ParseNames parses a BibTeX name list, such as the value of an author field.
+// Names are separated by "and" outside of braces.
+func ParseNames(s string) []Person {
+	var people []Person
+	var name []string
+	for _, word := range splitWords(s, isSpace) {
+		if strings.EqualFold(word, "and") {
+			if len(name) > 0 {
+				people = append(people, ParsePerson(strings.Join(name, " ")))
+			}
+			name = nil
+			continue
+		}
+		name = append(name, word)
+	}
+	if len(name) > 0 {
+		people = append(people, ParsePerson(strings.Join(name, " ")))
+	}
+	return people
+}
+
+// ParsePerson parses a single BibTeX name. Names may be given in any of the
+// forms "First von Last", "von Last, First" or "von Last, Jr, First". The von
+// part is the sequence of words starting with a lowercase letter.
+func ParsePerson(s string) Person {
+	var parts [][]string
+	for _, part := range splitWords(s, func(c byte) bool { return c == ',' }) {
+		parts = append(parts, splitWords(part, func(c byte) bool { return isSpace(c) || c == '~' }))
+	}
+
+	var p Person
+	switch len(parts) {
+	case 0:
+		return p
+	case 1:
+		words := parts[0]
+		n := len(words)
+
+		// First is the words before the first lowercase word, which may
+		// not be the last word.
+		i := 0
+		for i < n-1 && !isLowerWord(words[i]) {
+			i++
+		}
+		if i == n-1 {
+			p.First = strings.Join(words[:n-1], " ")
+			p.Last = words[n-1]
+			return p
+		}
+
+		p.First = strings.Join(words[:i], " ")
+		p.Von, p.Last = splitVonLast(words[i:])
+	default:
+		p.Von, p.Last = splitVonLast(parts[0])
+		if len(parts) > 2 {
+			p.Jr = strings.Join(parts[1], " ")
+			parts = parts[1:]
+		}
+		var rest []string
+		for _, part := range parts[1:] {
+			rest = append(rest, strings.Join(part, " "))
+		}
+		p.First = strings.Join(rest, ", ")
+	}
+	return p
+}
+
+// splitVonLast splits words into von and last parts. The von part extends to
+// the last lowercase word, provided it starts with one, and the last part is
+// never empty.
+func splitVonLast(words []string) (string, string) {
+	n := len(words)
+	if n == 0 {
+		return "", ""
+	}
+	j := -1
+	if isLowerWord(words[0]) {
+		for i := 0; i < n-1; i++ {
+			if isLowerWord(words[i]) {
+				j = i
+			}
+		}
+	}
+	return strings.Join(words[:j+1], " "), strings.Join(words[j+1:], " ")
+}
+
+// splitWords splits s at separator characters outside of braces, discarding
+// empty words.
+func splitWords(s string, sep func(c byte) bool) []string {
+	var words []string
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch c := s[i]; {
+			case c == '{':
+				depth++
+				continue
+			case c == '}':
+				depth--
+				continue
+			case depth > 0 || !sep(c):
+				continue
+			}
+		}
+		if word := strings.TrimSpace(s[start:i]); word != "" {
+			words = append(words, word)
+		}
+		start = i + 1
+	}
+	return words
+}
+
+// isLowerWord reports whether a word starts with a lowercase letter, and so
+// belongs to the von part of a name. Letters inside braces are ignored, except
+// for special characters such as {\"u} whose case is that of the character
+// they represent.
+func isLowerWord(word string) bool {
+	depth := 0
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		switch {
+		case c == '{' && depth == 0 && strings.HasPrefix(word[i+1:], `\`):
+			return isLowerSpecial(word[i+2:])
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case depth == 0 && isLetter(c):
+			return unicode.IsLower(rune(c))
+		}
+	}
+	return false
+}
+
+// isLowerSpecial reports whether the special character starting after the
+// backslash in s is lowercase. Control words such as \ss and \O determine
+// the case themselves, unless they are accents.
+func isLowerSpecial(s string) bool {
+	n := 0
+	for n < len(s) && isLetter(s[n]) {
+		n++
+	}
+	if n > 0 {
+		if _, accent := accents[s[:n]]; !accent {
+			return unicode.IsLower(rune(s[0]))
+		}
+	}
+	for i := n; i < len(s) && s[i] != '}'; i++ {
+		if isLetter(s[i]) {
+			return unicode.IsLower(rune(s[i]))
+		}
+	}
+	return false
+}
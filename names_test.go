@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePerson(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Expect Person
+	}{
+		{"Knuth", Person{Last: "Knuth"}},
+		{"Donald E. Knuth", Person{First: "Donald E.", Last: "Knuth"}},
+		{"Knuth, Donald E.", Person{First: "Donald E.", Last: "Knuth"}},
+		{"Ludwig van Beethoven", Person{First: "Ludwig", Von: "van", Last: "Beethoven"}},
+		{"van Beethoven, Ludwig", Person{First: "Ludwig", Von: "van", Last: "Beethoven"}},
+		{"Charles Louis Xavier Joseph de la Vall{\\'e}e Poussin", Person{First: "Charles Louis Xavier Joseph", Von: "de la", Last: "Vall{\\'e}e Poussin"}},
+		{"Ford, Jr., Henry", Person{First: "Henry", Last: "Ford", Jr: "Jr."}},
+		{"von Neumann, Jr, John", Person{First: "John", Von: "von", Last: "Neumann", Jr: "Jr"}},
+		{"{Barnes and Noble}", Person{Last: "{Barnes and Noble}"}},
+		{"{Barnes, Inc.}", Person{Last: "{Barnes, Inc.}"}},
+		{"Jean~de~La~Fontaine", Person{First: "Jean", Von: "de", Last: "La Fontaine"}},
+		{"{\\\"U}lrich Schmidt", Person{First: "{\\\"U}lrich", Last: "Schmidt"}},
+		{"{\\\"u}ber Schmidt", Person{Von: "{\\\"u}ber", Last: "Schmidt"}},
+		{"others", Others},
+	}
+	for _, c := range cases {
+		if got := ParsePerson(c.Input); got != c.Expect {
+			t.Errorf("ParsePerson(%q) = %#v; expect %#v", c.Input, got, c.Expect)
+		}
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	got := ParseNames("Knuth, Donald and {Barnes and Noble} AND Leslie Lamport and others")
+	expect := []Person{
+		{First: "Donald", Last: "Knuth"},
+		{Last: "{Barnes and Noble}"},
+		{First: "Leslie", Last: "Lamport"},
+		Others,
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %#v; expect %#v", got, expect)
+	}
+}
+
+func TestFormatAuthors(t *testing.T) {
+	authors := ParseNames(`Knuth, Donald Ervin and Jean-Paul Sartre and van Beethoven, Jr, Ludwig`)
+	cases := []struct {
+		Name   string
+		Format NameFormat
+		Expect string
+	}{
+		{"full", NameFormat{}, "Donald Ervin Knuth, Jean-Paul Sartre and Ludwig van Beethoven, Jr"},
+		{"initials", NameFormat{Initials: true, Serial: true}, "D. E. Knuth, J.-P. Sartre, and L. van Beethoven, Jr"},
+		{"inverted", NameFormat{Initials: true, Inverted: true, Conjunction: "&"}, "Knuth, D. E., Sartre, J.-P. & van Beethoven, Jr, L."},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			if got := FormatAuthors(authors, c.Format, PlainText); got != c.Expect {
+				t.Errorf("got    = %s", got)
+				t.Errorf("expect = %s", c.Expect)
+			}
+		})
+	}
+}
+
+func TestFormatAuthorsOthers(t *testing.T) {
+	authors := ParseNames("Donald Knuth and others")
+	expect := "Donald Knuth et al."
+	if got := FormatAuthors(authors, NameFormat{}, PlainText); got != expect {
+		t.Fatalf("got %q; expect %q", got, expect)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// generated matches the standard header for generated Go files.
+var generated = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// SourceFiles expands the given arguments to a list of Go source files.
+// Arguments may be filenames, package directories or recursive patterns
+// ending in "/...", such as "./...". Filenames are returned as given. Package
+// directories are expanded to the files matching the current build
+// constraints, skipping generated files. Recursive patterns also skip vendor,
+// testdata and hidden directories, as well as nested modules.
+func SourceFiles(args []string) ([]string, error) {
+	var filenames []string
+	for _, arg := range args {
+		// Recursive pattern.
+		if arg == "..." || strings.HasSuffix(arg, "/...") {
+			root := strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/")
+			if root == "" {
+				root = "."
+			}
+			files, err := walkPackages(root)
+			if err != nil {
+				return nil, err
+			}
+			filenames = append(filenames, files...)
+			continue
+		}
+
+		// Package directory.
+		info, err := os.Stat(arg)
+		if err == nil && info.IsDir() {
+			files, err := packageFiles(arg)
+			if err != nil {
+				return nil, err
+			}
+			filenames = append(filenames, files...)
+			continue
+		}
+
+		// Otherwise assume a filename.
+		filenames = append(filenames, arg)
+	}
+	return filenames, nil
+}
+
+// walkPackages returns source files in all packages under root.
+func walkPackages(root string) ([]string, error) {
+	var filenames []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		// Skip directories the go tool ignores, and nested modules.
+		if path != root {
+			name := info.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		files, err := packageFiles(path)
+		if err != nil {
+			return err
+		}
+		filenames = append(filenames, files...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filenames, nil
+}
+
+// packageFiles returns the non-generated source files in the package in dir
+// that match the current build constraints.
+func packageFiles(dir string) ([]string, error) {
+	pkg, err := build.ImportDir(dir, 0)
+	var nogo *build.NoGoError
+	if errors.As(err, &nogo) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	names = append(names, pkg.GoFiles...)
+	names = append(names, pkg.CgoFiles...)
+	names = append(names, pkg.TestGoFiles...)
+	names = append(names, pkg.XTestGoFiles...)
+	sort.Strings(names)
+
+	var filenames []string
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		gen, err := IsGenerated(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !gen {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames, nil
+}
+
+// IsGenerated reports whether the Go source file has a "Code generated ... DO
+// NOT EDIT." header before the package clause.
+func IsGenerated(filename string) (bool, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if generated.MatchString(line) {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return false, scanner.Err()
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
-	"os"
+	"io/ioutil"
 	"regexp"
 	"sort"
 	"strings"
@@ -18,45 +20,112 @@ const ReferencesMarker = "// References:"
 // citations is the regular expression for citations in comments.
 var citations = regexp.MustCompile(`\[[a-zA-Z0-9:/\-]{3,}\]`)
 
+// bareURLs is the regular expression for bare URLs in comments.
+var bareURLs = regexp.MustCompile("https?://[^\\s<>\"'`]+")
+
+// Citation is an occurrence of a citation in a source file.
+type Citation struct {
+	Key string
+	Pos token.Position
+}
+
+// SourceLink is an occurrence of a URL in a source file.
+type SourceLink struct {
+	URL string
+	Pos token.Position
+}
+
 // Source represents a parsed source file with references.
 type Source struct {
 	Lines     []string
 	InsertAt  int
 	Citations map[string]bool
+
+	// Occurrences lists every citation in the order they appear.
+	Occurrences []Citation
+
+	// Links lists every URL in comments outside the reference block, in the
+	// order they appear.
+	Links []SourceLink
+
+	// Style for formatting references. Uses DefaultStyle if nil.
+	Style Style
 }
 
-// Parse a source file.
-func Parse(r io.Reader) (*Source, error) {
+// Parse a Go source file. The filename is only used for position information.
+func Parse(filename string, src []byte) (*Source, error) {
 	s := &Source{
 		InsertAt:  -1,
 		Citations: map[string]bool{},
 	}
 
-	scanner := bufio.NewScanner(r)
+	// Parse the file to locate comments. Only comments recognized by the Go
+	// parser are searched for citations, so comment-like text inside string
+	// literals is ignored while block comments are included.
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record lines that consist of a line comment only, and the physical
+	// line of each link.
+	linecomments := map[int]bool{}
+	linklines := []int{}
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			for _, m := range citations.FindAllStringIndex(c.Text, -1) {
+				key := c.Text[m[0]+1 : m[1]-1]
+				s.Citations[key] = true
+				s.Occurrences = append(s.Occurrences, Citation{
+					Key: key,
+					Pos: fset.Position(c.Slash + token.Pos(m[0])),
+				})
+			}
+
+			for _, m := range bareURLs.FindAllStringIndex(c.Text, -1) {
+				s.Links = append(s.Links, SourceLink{
+					URL: trimURL(c.Text[m[0]:m[1]]),
+					Pos: fset.Position(c.Slash + token.Pos(m[0])),
+				})
+				linklines = append(linklines, fset.PositionFor(c.Slash+token.Pos(m[0]), false).Line)
+			}
+
+			// Use the physical position, unaffected by //line directives,
+			// since it is matched against the lines of src.
+			pos := fset.PositionFor(c.Slash, false)
+			indent := src[pos.Offset-pos.Column+1 : pos.Offset]
+			if strings.HasPrefix(c.Text, "//") && len(bytes.TrimSpace(indent)) == 0 {
+				linecomments[pos.Line] = true
+			}
+		}
+	}
+
+	// Process lines, removing any existing reference block.
+	scanner := bufio.NewScanner(bytes.NewReader(src))
 	insideReferenceBlock := false
+	referenceLines := map[int]bool{}
 
-	for scanner.Scan() {
+	for n := 1; scanner.Scan(); n++ {
 		line := scanner.Text()
 
 		// Is this the start of the reference block?
-		if line == ReferencesMarker && s.InsertAt < 0 {
+		if line == ReferencesMarker && linecomments[n] && s.InsertAt < 0 {
 			s.InsertAt = len(s.Lines)
 			insideReferenceBlock = true
 			continue
 		}
 
-		if IsComment(line) {
-			// Look for citations.
-			keys := ParseCitations(line)
-			for _, key := range keys {
-				s.Citations[key] = true
-			}
-		} else if insideReferenceBlock {
+		// The reference block continues until the first line that is not a
+		// comment.
+		if insideReferenceBlock && !linecomments[n] {
 			insideReferenceBlock = false
 		}
 
 		// Record the line.
-		if !insideReferenceBlock {
+		if insideReferenceBlock {
+			referenceLines[n] = true
+		} else {
 			s.Lines = append(s.Lines, line)
 		}
 	}
@@ -65,47 +134,89 @@ func Parse(r io.Reader) (*Source, error) {
 		return nil, err
 	}
 
+	// Links in the reference block come from the bibliography, so are
+	// checked there.
+	found := s.Links
+	s.Links = nil
+	for i, link := range found {
+		if !referenceLines[linklines[i]] {
+			s.Links = append(s.Links, link)
+		}
+	}
+
 	return s, nil
 }
 
+// trimURL removes trailing punctuation that is likely to belong to the
+// surrounding text rather than the URL. Closing brackets are only removed if
+// they are unbalanced, so URLs such as Wikipedia articles are kept intact.
+func trimURL(u string) string {
+	for len(u) > 0 {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(".,;:!?", last) >= 0:
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"):
+		case last == ']' && strings.Count(u, "[") < strings.Count(u, "]"):
+		default:
+			return u
+		}
+		u = u[:len(u)-1]
+	}
+	return u
+}
+
 // ParseFile parses a source file for citations and references.
-func ParseFile(path string) (s *Source, err error) {
-	f, err := os.Open(path)
+func ParseFile(path string) (*Source, error) {
+	src, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if errc := f.Close(); err == nil && errc != nil {
-			err = errc
-		}
-	}()
+	return Parse(path, src)
+}
 
-	return Parse(f)
+// UnknownReferenceError reports a citation of a key that is not in the
+// bibliography.
+type UnknownReferenceError struct {
+	Citation
 }
 
-// IsComment returns whether the line is a comment.
-func IsComment(line string) bool {
-	line = strings.TrimSpace(line)
-	return strings.HasPrefix(line, "//")
+func (e UnknownReferenceError) Error() string {
+	return fmt.Sprintf("%s: unknown reference [%s]", e.Pos, e.Key)
 }
 
-// ParseCitations parses citations from a line.
-func ParseCitations(line string) []string {
-	keys := []string{}
-	matches := citations.FindAllString(line, -1)
-	for _, match := range matches {
-		keys = append(keys, match[1:len(match)-1])
+// BrokenLinkError reports a URL in a source file that failed the link check.
+type BrokenLinkError struct {
+	SourceLink
+	Err error
+}
+
+func (e BrokenLinkError) Error() string {
+	return fmt.Sprintf("%s: broken link %s: %s", e.Pos, e.URL, e.Err)
+}
+
+// ErrorList is a list of errors.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
 	}
-	return keys
+	return strings.Join(msgs, "\n")
 }
 
-// Validate the citations in the source.
+// Validate the citations in the source. Returns an ErrorList containing an
+// UnknownReferenceError for every citation that is not in the bibliography.
 func (s *Source) Validate(b *Bibliography) error {
-	for key := range s.Citations {
-		if b.Lookup(key) == nil {
-			return fmt.Errorf("unknown reference %q", key)
+	var errs ErrorList
+	for _, c := range s.Occurrences {
+		if b.Lookup(c.Key) == nil {
+			errs = append(errs, UnknownReferenceError{Citation: c})
 		}
 	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -155,8 +266,13 @@ func (s *Source) writeReferences(w io.Writer, b *Bibliography) error {
 	tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', tabwriter.StripEscape)
 	leader := []byte{tabwriter.Escape, '/', '/', '\t', tabwriter.Escape}
 
+	style := s.Style
+	if style == nil {
+		style = DefaultStyle
+	}
+
 	for _, e := range entries {
-		formatted, err := Format(e)
+		formatted, err := FormatStyle(e, style, PlainText)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseCitations(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Source string
+		Expect []string
+	}{
+		{
+			Name: "line_comment",
+			Source: `package p
+
+// Cite [line].
+var x = 1
+`,
+			Expect: []string{"line"},
+		},
+		{
+			Name: "block_comment",
+			Source: `package p
+
+/*
+Cite [block] in a block comment.
+*/
+var x = 1 /* and [inline] */
+`,
+			Expect: []string{"block", "inline"},
+		},
+		{
+			Name:   "string_literals",
+			Source: "package p\n\nvar raw = `\n// [notraw]\n`\n\nvar s = \"// [notstring]\"\n",
+			Expect: []string{},
+		},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Name, func(t *testing.T) {
+			s, err := Parse(c.Name+".go", []byte(c.Source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for key := range s.Citations {
+				got = append(got, key)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, c.Expect) {
+				t.Fatalf("got citations %v; expect %v", got, c.Expect)
+			}
+		})
+	}
+}
+
+func TestParseReferencesBlock(t *testing.T) {
+	src := "package p\n\n// References:\n//\n//\t[old]  Old reference.\n\nvar raw = `\n// References:\n`\n"
+	s, err := Parse("block.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"package p",
+		"",
+		"",
+		"var raw = `",
+		"// References:",
+		"`",
+	}
+	if !reflect.DeepEqual(s.Lines, expect) {
+		t.Fatalf("got lines %q; expect %q", s.Lines, expect)
+	}
+	if s.InsertAt != 2 {
+		t.Fatalf("got insertion point %d; expect 2", s.InsertAt)
+	}
+}
+
+func TestParseOccurrences(t *testing.T) {
+	src := "package p\n\n// Cite [one] and [two].\n/*\n\t[one]\n*/\n"
+	s, err := Parse("pos.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, c := range s.Occurrences {
+		got = append(got, c.Key+"@"+c.Pos.String())
+	}
+	expect := []string{
+		"one@pos.go:3:9",
+		"two@pos.go:3:19",
+		"one@pos.go:5:2",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got occurrences %v; expect %v", got, expect)
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	src := "package p\n\n" +
+		"// See https://example.com/a, and (https://example.com/b).\n" +
+		"// Also https://en.wikipedia.org/wiki/Go_(programming_language).\n" +
+		"var s = \"https://example.com/literal\"\n"
+	s, err := Parse("links.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, l := range s.Links {
+		got = append(got, l.URL+"@"+l.Pos.String())
+	}
+	expect := []string{
+		"https://example.com/a@links.go:3:8",
+		"https://example.com/b@links.go:3:36",
+		"https://en.wikipedia.org/wiki/Go_(programming_language)@links.go:4:9",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got links %v; expect %v", got, expect)
+	}
+}
+
+func TestParseLineDirective(t *testing.T) {
+	// Positions are reported as adjusted by the //line directive, while the
+	// reference block is found on the physical lines.
+	src := "package p\n\n//line gen.y:10:40\n// See [hello] at https://example.com/a.\n\n// References:\n//\n//\t[old]  Old. https://example.com/old\n\nfunc f() {}\n"
+	s, err := Parse("gen.go", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.InsertAt != 5 {
+		t.Errorf("got insertion point %d; expect 5", s.InsertAt)
+	}
+	for _, line := range s.Lines {
+		if strings.Contains(line, "[old]") {
+			t.Errorf("reference block line %q not removed", line)
+		}
+	}
+
+	got := []string{}
+	for _, c := range s.Occurrences {
+		got = append(got, c.Key+"@"+c.Pos.String())
+	}
+	expect := []string{"hello@gen.y:10:47", "old@gen.y:14:4"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got occurrences %v; expect %v", got, expect)
+	}
+
+	// Links in the reference block are skipped.
+	got = []string{}
+	for _, l := range s.Links {
+		got = append(got, l.URL+"@"+l.Pos.String())
+	}
+	expect = []string{"https://example.com/a@gen.y:10:58"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got links %v; expect %v", got, expect)
+	}
+}
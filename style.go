@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Style renders references as text.
+type Style interface {
+	Format(r *Reference) string
+}
+
+// StyleFunc adapts a function to the Style interface.
+type StyleFunc func(r *Reference) string
+
+// Format calls f(r).
+func (f StyleFunc) Format(r *Reference) string { return f(r) }
+
+// DefaultStyle is the style used when none is specified.
+var DefaultStyle Style = StyleFunc(defaultStyle)
+
+// styles is the registry of builtin styles.
+var styles = map[string]Style{
+	"default": DefaultStyle,
+	"ieee":    StyleFunc(ieeeStyle),
+	"acm":     StyleFunc(acmStyle),
+	"apa":     StyleFunc(apaStyle),
+	"chicago": StyleFunc(chicagoStyle),
+}
+
+// LookupStyle returns the builtin style with the given name.
+func LookupStyle(name string) (Style, error) {
+	style, ok := styles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown style %q", name)
+	}
+	return style, nil
+}
+
+// BuiltinStyleNames returns names of builtin styles.
+func BuiltinStyleNames() []string {
+	names := []string{}
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EtAl returns a style that lists at most n authors, followed by "et al.".
+func EtAl(style Style, n int) Style {
+	return StyleFunc(func(r *Reference) string {
+		truncated := *r
+		truncated.Authors = etal(r.Authors, n)
+		truncated.Editors = etal(r.Editors, n)
+		return style.Format(&truncated)
+	})
+}
+
+// etal truncates a list of names to at most n, followed by Others.
+func etal(names []Person, n int) []Person {
+	if len(names) <= n {
+		return names
+	}
+	return append(names[:n:n], Others)
+}
+
+// defaultStyle renders references in the form:
+//
+//	Authors. Title. Details. Year. URL (accessed Date)
+func defaultStyle(r *Reference) string {
+	s := ""
+	if names := r.Names(NameFormat{}); names != "" {
+		s = sentence(names) + " "
+	}
+	s += r.Title + "."
+
+	for _, detail := range r.Details {
+		s += " " + detail + "."
+	}
+
+	if date := published(r); date != "" {
+		s += " " + date + "."
+	}
+
+	if r.URL != "" {
+		s += " " + r.URL
+	}
+
+	if !r.Accessed.IsZero() {
+		s += " (accessed " + r.Accessed.Format("January 2, 2006") + ")"
+	}
+
+	for _, alt := range alternatives(r) {
+		s += " " + alt
+	}
+
+	for _, id := range r.Identifiers {
+		s += " " + id
+	}
+
+	return s
+}
+
+// ieeeStyle renders references in the style of the IEEE reference guide:
+//
+//	Authors, "Title," Details, Year. [Online]. Available: URL (accessed Date).
+func ieeeStyle(r *Reference) string {
+	parts := []string{}
+	if names := r.Names(NameFormat{Initials: true, Serial: true}); names != "" {
+		parts = append(parts, names+",")
+	}
+
+	rest := append([]string{}, r.Details...)
+	if date := published(r); date != "" {
+		rest = append(rest, date)
+	}
+
+	if len(rest) > 0 {
+		parts = append(parts, `"`+r.Title+`,"`, strings.Join(rest, ", ")+".")
+	} else {
+		parts = append(parts, `"`+r.Title+`."`)
+	}
+
+	if r.URL != "" {
+		parts = append(parts, "[Online]. Available: "+r.URL)
+	}
+
+	if !r.Accessed.IsZero() {
+		parts = append(parts, "(accessed "+r.Accessed.Format("Jan. 2, 2006")+").")
+	}
+
+	parts = append(parts, alternatives(r)...)
+
+	parts = append(parts, r.Identifiers...)
+
+	return strings.Join(parts, " ")
+}
+
+// acmStyle renders references in the style of the ACM reference format:
+//
+//	Authors. Year. Title. Details. Retrieved Date from URL
+//
+// References without authors lead with the title, followed by the year.
+func acmStyle(r *Reference) string {
+	parts := []string{}
+	names := r.Names(NameFormat{Serial: true})
+	if names != "" {
+		parts = append(parts, sentence(names))
+	} else {
+		parts = append(parts, sentence(r.Title))
+	}
+	if r.Year != "" {
+		parts = append(parts, r.Year+".")
+	}
+	if names != "" {
+		parts = append(parts, sentence(r.Title))
+	}
+	for _, detail := range r.Details {
+		parts = append(parts, sentence(detail))
+	}
+
+	switch {
+	case r.URL != "" && !r.Accessed.IsZero():
+		parts = append(parts, "Retrieved "+r.Accessed.Format("January 2, 2006")+" from "+r.URL)
+	case r.URL != "":
+		parts = append(parts, r.URL)
+	}
+
+	parts = append(parts, alternatives(r)...)
+
+	parts = append(parts, r.Identifiers...)
+
+	return strings.Join(parts, " ")
+}
+
+// apaStyle renders references in the style of the APA publication manual:
+//
+//	Authors (Year). Title. Details. Retrieved Date, from URL
+//
+// References without authors lead with the title, followed by the year.
+func apaStyle(r *Reference) string {
+	year := r.Year
+	if year == "" {
+		year = "n.d."
+	}
+
+	parts := []string{}
+	names := r.Names(NameFormat{Initials: true, Inverted: true, Conjunction: "&", Serial: true})
+	if names != "" {
+		parts = append(parts, names, "("+year+").", sentence(r.Title))
+	} else {
+		parts = append(parts, sentence(r.Title), "("+year+").")
+	}
+	for _, detail := range r.Details {
+		parts = append(parts, sentence(detail))
+	}
+
+	switch {
+	case r.URL != "" && !r.Accessed.IsZero():
+		parts = append(parts, "Retrieved "+r.Accessed.Format("January 2, 2006")+", from "+r.URL)
+	case r.URL != "":
+		parts = append(parts, r.URL)
+	}
+
+	parts = append(parts, alternatives(r)...)
+
+	parts = append(parts, r.Identifiers...)
+
+	return strings.Join(parts, " ")
+}
+
+// chicagoStyle renders references in the author-date style of the Chicago
+// Manual of Style:
+//
+//	Authors. Year. "Title." Details. Accessed Date. URL.
+//
+// References without authors lead with the title, followed by the year.
+func chicagoStyle(r *Reference) string {
+	year := r.Year
+	if year == "" {
+		year = "n.d."
+	}
+
+	title := `"` + sentence(r.Title) + `"`
+	parts := []string{}
+	if names := r.Names(NameFormat{Serial: true}); names != "" {
+		parts = append(parts, sentence(names), sentence(year), title)
+	} else {
+		parts = append(parts, title, sentence(year))
+	}
+	for _, detail := range r.Details {
+		parts = append(parts, sentence(detail))
+	}
+
+	if !r.Accessed.IsZero() {
+		parts = append(parts, "Accessed "+r.Accessed.Format("January 2, 2006")+".")
+	}
+
+	if r.URL != "" {
+		parts = append(parts, r.URL+".")
+	}
+
+	parts = append(parts, alternatives(r)...)
+
+	parts = append(parts, r.Identifiers...)
+
+	return strings.Join(parts, " ")
+}
+
+// alternatives returns the mirror and archive locations for display, such as
+// "(archived: URL)".
+func alternatives(r *Reference) []string {
+	var alts []string
+	if r.Mirror != "" {
+		alts = append(alts, "(mirror: "+r.Mirror+")")
+	}
+	if r.Archive != "" {
+		alts = append(alts, "(archived: "+r.Archive+")")
+	}
+	return alts
+}
+
+// published returns the date of publication for display. This is the full
+// date if it is known more precisely than the year.
+func published(r *Reference) string {
+	if r.Date.Start.Month != 0 || r.Date.End.Month != 0 {
+		return r.Date.Long()
+	}
+	return r.Year
+}
+
+// joinAuthors joins a list of authors with the given conjunction before the
+// last. With serial set, lists of three or more have a comma before the
+// conjunction.
+func joinAuthors(authors []string, conj string, serial bool) string {
+	n := len(authors)
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return authors[0]
+	case 2:
+		return authors[0] + " " + conj + " " + authors[1]
+	}
+
+	sep := " "
+	if serial {
+		sep = ", "
+	}
+	return strings.Join(authors[:n-1], ", ") + sep + conj + " " + authors[n-1]
+}
+
+// sentence terminates s with a period, unless it already ends with
+// punctuation.
+func sentence(s string) string {
+	if strings.HasSuffix(s, ".") || strings.HasSuffix(s, "?") || strings.HasSuffix(s, "!") {
+		return s
+	}
+	return s + "."
+}
@@ -0,0 +1,171 @@
+package main
+
+import "testing"
+
+func TestStyles(t *testing.T) {
+	entries := map[string]TestEntry{
+		"inproceedings": {
+			Name: "inproceedings",
+			Type: "inproceedings",
+			Fields: map[string]string{
+				"author":    "First Author and Second Author and Third Author",
+				"title":     "Title",
+				"booktitle": "Handbook of Golang",
+				"pages":     "42--78",
+				"year":      "2020",
+			},
+		},
+		"misc": {
+			Name: "misc",
+			Type: "misc",
+			Fields: map[string]string{
+				"author":  "First Author and Second Author",
+				"title":   "Title",
+				"url":     "https://golang.org",
+				"urldate": "2020-02-06",
+			},
+		},
+		"archived": {
+			Name: "archived",
+			Type: "misc",
+			Fields: map[string]string{
+				"author":     "First Author",
+				"title":      "Title",
+				"url":        "https://golang.org",
+				"urldate":    "2020-02-06",
+				"archiveurl": "https://web.archive.org/web/2020/https://golang.org",
+			},
+		},
+		"anonymous": {
+			Name: "anonymous",
+			Type: "misc",
+			Fields: map[string]string{
+				"title":        "Title",
+				"howpublished": "Handed out at GopherCon",
+				"year":         "2019",
+			},
+		},
+	}
+
+	cases := []struct {
+		Style  string
+		Entry  string
+		Expect string
+	}{
+		{
+			Style:  "default",
+			Entry:  "inproceedings",
+			Expect: "First Author, Second Author and Third Author. Title. In Handbook of Golang, pages 42–78. 2020.",
+		},
+		{
+			Style:  "default",
+			Entry:  "misc",
+			Expect: "First Author and Second Author. Title. https://golang.org (accessed February 6, 2020)",
+		},
+		{
+			Style:  "ieee",
+			Entry:  "inproceedings",
+			Expect: `F. Author, S. Author, and T. Author, "Title," In Handbook of Golang, pages 42–78, 2020.`,
+		},
+		{
+			Style:  "ieee",
+			Entry:  "misc",
+			Expect: `F. Author and S. Author, "Title." [Online]. Available: https://golang.org (accessed Feb. 6, 2020).`,
+		},
+		{
+			Style:  "acm",
+			Entry:  "inproceedings",
+			Expect: "First Author, Second Author, and Third Author. 2020. Title. In Handbook of Golang, pages 42–78.",
+		},
+		{
+			Style:  "acm",
+			Entry:  "misc",
+			Expect: "First Author and Second Author. Title. Retrieved February 6, 2020 from https://golang.org",
+		},
+		{
+			Style:  "apa",
+			Entry:  "inproceedings",
+			Expect: "Author, F., Author, S., & Author, T. (2020). Title. In Handbook of Golang, pages 42–78.",
+		},
+		{
+			Style:  "apa",
+			Entry:  "misc",
+			Expect: "Author, F. & Author, S. (n.d.). Title. Retrieved February 6, 2020, from https://golang.org",
+		},
+		{
+			Style:  "chicago",
+			Entry:  "inproceedings",
+			Expect: `First Author, Second Author, and Third Author. 2020. "Title." In Handbook of Golang, pages 42–78.`,
+		},
+		{
+			Style:  "chicago",
+			Entry:  "misc",
+			Expect: `First Author and Second Author. n.d. "Title." Accessed February 6, 2020. https://golang.org.`,
+		},
+		{
+			Style:  "default",
+			Entry:  "archived",
+			Expect: "First Author. Title. https://golang.org (accessed February 6, 2020) (archived: https://web.archive.org/web/2020/https://golang.org)",
+		},
+		{
+			Style:  "ieee",
+			Entry:  "archived",
+			Expect: `F. Author, "Title." [Online]. Available: https://golang.org (accessed Feb. 6, 2020). (archived: https://web.archive.org/web/2020/https://golang.org)`,
+		},
+		{
+			Style:  "apa",
+			Entry:  "archived",
+			Expect: "Author, F. (n.d.). Title. Retrieved February 6, 2020, from https://golang.org (archived: https://web.archive.org/web/2020/https://golang.org)",
+		},
+		{
+			Style:  "default",
+			Entry:  "anonymous",
+			Expect: "Title. Handed out at GopherCon. 2019.",
+		},
+		{
+			Style:  "ieee",
+			Entry:  "anonymous",
+			Expect: `"Title," Handed out at GopherCon, 2019.`,
+		},
+		{
+			Style:  "acm",
+			Entry:  "anonymous",
+			Expect: "Title. 2019. Handed out at GopherCon.",
+		},
+		{
+			Style:  "apa",
+			Entry:  "anonymous",
+			Expect: "Title. (2019). Handed out at GopherCon.",
+		},
+		{
+			Style:  "chicago",
+			Entry:  "anonymous",
+			Expect: `"Title." 2019. Handed out at GopherCon.`,
+		},
+	}
+	for _, c := range cases {
+		c := c // scopelint
+		t.Run(c.Style+"_"+c.Entry, func(t *testing.T) {
+			style, err := LookupStyle(c.Style)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FormatStyle(entries[c.Entry].Entry(), style, PlainText)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.Expect {
+				t.Logf("got    = %s", got)
+				t.Logf("expect = %s", c.Expect)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestLookupStyleUnknown(t *testing.T) {
+	expect := `unknown style "unknown"`
+	if _, err := LookupStyle("unknown"); err == nil || err.Error() != expect {
+		t.Fatalf("got error %v; expected %s", err, expect)
+	}
+}
@@ -4,6 +4,6 @@ package main
 
 var (
 	templates = map[string]string{
-"/markdown.tmpl": "# Bibliography\n\n{{ range .Entries -}}\n* {{ .Formatted }}\n{{ end }}\n",
+"/markdown.tmpl": "# Bibliography\n\n{{ range .Entries -}}\n* {{ .Markdown }}\n{{ end }}\n",
 }
 )
\ No newline at end of file